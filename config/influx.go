@@ -0,0 +1,315 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"venu-data/internal/selector"
+)
+
+// InfluxConfig 对应配置文件中的 influx 块
+type InfluxConfig struct {
+	// Precision 写入精度，取值 ns、us、ms、s，默认 ns
+	Precision string `json:"precision"`
+	// TimestampFallback 消息没有时间戳时使用的时间，ingest 为写入时间，kafka 为 Kafka 消息时间，默认 ingest
+	TimestampFallback string `json:"timestamp_fallback"`
+	// InvalidTimestamp 时间戳无法解析时的处理方式，fallback 按 TimestampFallback 取时间，reject 丢弃消息，默认 fallback
+	InvalidTimestamp string `json:"invalid_timestamp"`
+
+	// Version 为 2 时通过 /api/v2/write 写入 InfluxDB 2.x/3.x，默认 1
+	Version int    `json:"version"`
+	Org     string `json:"org"`
+	// Buckets 库名到 bucket 的映射，未配置的库使用同名 bucket
+	Buckets map[string]string `json:"buckets"`
+	// Token 按 TokenFile、TokenEnv、Token 的顺序取第一个配置的
+	Token     string `json:"token"`
+	TokenFile string `json:"token_file"`
+	TokenEnv  string `json:"token_env"`
+	Gzip      bool   `json:"gzip"`
+
+	// 1.x 账号，密码按 PasswordFile、PasswordEnv、Password 的顺序取第一个配置的
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	PasswordFile string `json:"password_file"`
+	PasswordEnv  string `json:"password_env"`
+
+	// Https 使用 HTTPS 连接，CaFile 为自定义 CA，InsecureSkipVerify 跳过证书校验
+	Https              bool   `json:"https"`
+	CaFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+
+	// RetentionPolicy、WriteConsistency 为 1.x 写入参数，为空时使用服务端默认值
+	RetentionPolicy  string `json:"retention_policy"`
+	WriteConsistency string `json:"write_consistency"`
+	// SkipCreateDatabase 账号没有管理员权限时跳过 create database
+	SkipCreateDatabase bool `json:"skip_create_database"`
+}
+
+// TimestampConfig 按主题配置的时间戳解析规则。
+// 字符串依次按 Layouts 解析，不含时区的时间按 Timezone 解释；数字及纯数字字符串按 EpochUnit 解析为 Unix 时间
+type TimestampConfig struct {
+	// Layouts Go 时间格式，默认只有 RFC3339Nano
+	Layouts []string `json:"layouts"`
+	// EpochUnit 取值 s、ms、us、ns，默认 auto，按数值大小推断
+	EpochUnit string `json:"epoch_unit"`
+	// Timezone 如 Asia/Shanghai，默认本地时区
+	Timezone string `json:"timezone"`
+}
+
+// InfluxFieldRule 匹配 Measurement 通配的点按 Fields 转换字段类型，类型取值 int、float、string、bool；
+// 嵌套的字段按 Separator 展开，默认为 _
+type InfluxFieldRule struct {
+	Measurement string            `json:"measurement"`
+	Fields      map[string]string `json:"fields"`
+	Separator   string            `json:"separator"`
+}
+
+func GetInfluxFieldRules() []InfluxFieldRule {
+	return config.InfluxFieldRules
+}
+
+// PointMapping 把任意 JSON 映射为 InfluxDB 点，见 README。
+// 以 $ 开头的选择器从消息根节点取值，以 @ 开头的从 Explode 展开的元素取值，其他取值为字面量
+type PointMapping struct {
+	DbName      string            `json:"db_name"`
+	Measurement string            `json:"measurement"`
+	Explode     string            `json:"explode"`
+	Tags        map[string]string `json:"tags"`
+	Fields      map[string]string `json:"fields"`
+	FieldsFrom  string            `json:"fields_from"`
+	Timestamp   string            `json:"timestamp"`
+}
+
+// validateMapping 编译所有选择器，表达式有误时启动失败，而不是在消费时才报错
+func validateMapping(mapping *PointMapping) error {
+	expressions := []string{mapping.DbName, mapping.Measurement, mapping.Explode, mapping.FieldsFrom, mapping.Timestamp}
+	for _, expr := range mapping.Tags {
+		expressions = append(expressions, expr)
+	}
+
+	for _, expr := range mapping.Fields {
+		expressions = append(expressions, expr)
+	}
+
+	for _, expr := range expressions {
+		if _, err := selector.Compile(expr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InfluxRollupRule 按 Window 秒的滚动窗口聚合匹配 Measurement 通配的点，按 GroupBy 中的标签分组。
+// Aggregates 为字段名或通配到聚合函数的映射，取值 mean、min、max、sum、last、count；
+// 聚合结果写入 Target（可包含 {measurement}，默认 {measurement}_<Window>s）及 RetentionPolicy，
+// 窗口结束 Delay 秒后输出，DropRaw 为 true 时不再写入原始点
+type InfluxRollupRule struct {
+	Measurement     string              `json:"measurement"`
+	Window          int                 `json:"window"`
+	Delay           int                 `json:"delay"`
+	GroupBy         []string            `json:"group_by"`
+	Aggregates      map[string][]string `json:"aggregates"`
+	Target          string              `json:"target"`
+	RetentionPolicy string              `json:"retention_policy"`
+	DropRaw         bool                `json:"drop_raw"`
+}
+
+func GetInfluxRollupRules() []InfluxRollupRule {
+	return config.InfluxRollups
+}
+
+// InfluxTagLimit 匹配 Measurement 和 Tag 通配的标签，每个库、measurement、标签在 Window 秒内最多记录 Limit 个不同的值，
+// 超出后按 Action 处理新值：drop_tag 去掉标签，demote_to_field 改为字段，reject 丢弃整个点。
+// Window 结束后已记录的值清空重新计数，默认 3600
+type InfluxTagLimit struct {
+	Measurement string `json:"measurement"`
+	Tag         string `json:"tag"`
+	Limit       int    `json:"limit"`
+	Action      string `json:"action"`
+	Window      int    `json:"window"`
+}
+
+func GetInfluxTagLimits() []InfluxTagLimit {
+	return config.InfluxTagLimits
+}
+
+func GetInfluxConfig() InfluxConfig {
+	if config.Influx == nil {
+		return InfluxConfig{}
+	}
+
+	return *config.Influx
+}
+
+// InfluxBucket 返回库名对应的 bucket
+func InfluxBucket(db string) string {
+	if bucket, ok := GetInfluxConfig().Buckets[db]; ok {
+		return bucket
+	}
+
+	return db
+}
+
+// resolveSecret 依次从文件、环境变量读取密钥，都未配置时返回 value
+func resolveSecret(name string, value string, file string, env string) (string, error) {
+	switch {
+	case file != "":
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("读取 influx %s 文件失败：%v", name, err)
+		}
+
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case env != "":
+		secret, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("环境变量 %s 未设置", env)
+		}
+
+		return secret, nil
+	}
+
+	return value, nil
+}
+
+// resolveInfluxConfig 检查 influx 块中的取值，并解析 token
+func resolveInfluxConfig() error {
+	if config.Influx == nil {
+		config.Influx = &InfluxConfig{}
+	}
+
+	conf := config.Influx
+	switch conf.Version {
+	case 0, 1:
+	case 2:
+		if conf.Org == "" {
+			return fmt.Errorf("influx 2.x 需要配置 org")
+		}
+
+		token, err := resolveSecret("token", conf.Token, conf.TokenFile, conf.TokenEnv)
+		if err != nil {
+			return err
+		}
+
+		conf.Token = token
+	default:
+		return fmt.Errorf("influx version 配置有误：%d", conf.Version)
+	}
+
+	password, err := resolveSecret("password", conf.Password, conf.PasswordFile, conf.PasswordEnv)
+	if err != nil {
+		return err
+	}
+
+	conf.Password = password
+
+	switch conf.WriteConsistency {
+	case "", "any", "one", "quorum", "all":
+	default:
+		return fmt.Errorf("influx write_consistency 配置有误：%s", conf.WriteConsistency)
+	}
+
+	switch conf.Precision {
+	case "", "ns", "us", "ms", "s":
+	default:
+		return fmt.Errorf("influx precision 配置有误：%s", conf.Precision)
+	}
+
+	switch conf.TimestampFallback {
+	case "", "ingest", "kafka":
+	default:
+		return fmt.Errorf("influx timestamp_fallback 配置有误：%s", conf.TimestampFallback)
+	}
+
+	switch conf.InvalidTimestamp {
+	case "", "fallback", "reject":
+	default:
+		return fmt.Errorf("influx invalid_timestamp 配置有误：%s", conf.InvalidTimestamp)
+	}
+
+	for _, rule := range config.InfluxFieldRules {
+		for field, fieldType := range rule.Fields {
+			switch fieldType {
+			case "int", "float", "string", "bool":
+			default:
+				return fmt.Errorf("influx 字段 %s.%s 的类型配置有误：%s", rule.Measurement, field, fieldType)
+			}
+		}
+	}
+
+	for _, rule := range config.InfluxRollups {
+		if rule.Window <= 0 {
+			return fmt.Errorf("influx 聚合 %s 的 window 配置有误：%d", rule.Measurement, rule.Window)
+		}
+
+		for field, aggregates := range rule.Aggregates {
+			for _, aggregate := range aggregates {
+				switch aggregate {
+				case "mean", "min", "max", "sum", "last", "count":
+				default:
+					return fmt.Errorf("influx 聚合 %s.%s 的聚合函数有误：%s", rule.Measurement, field, aggregate)
+				}
+			}
+		}
+	}
+
+	for _, limit := range config.InfluxTagLimits {
+		if limit.Limit <= 0 {
+			return fmt.Errorf("influx 标签 %s.%s 的 limit 配置有误：%d", limit.Measurement, limit.Tag, limit.Limit)
+		}
+
+		if limit.Window < 0 {
+			return fmt.Errorf("influx 标签 %s.%s 的 window 配置有误：%d", limit.Measurement, limit.Tag, limit.Window)
+		}
+
+		switch limit.Action {
+		case "drop_tag", "demote_to_field", "reject":
+		default:
+			return fmt.Errorf("influx 标签 %s.%s 的 action 配置有误：%s", limit.Measurement, limit.Tag, limit.Action)
+		}
+	}
+
+	for _, topic := range config.Topics {
+		switch topic.Precision {
+		case "", "ns", "us", "ms", "s":
+		default:
+			return fmt.Errorf("主题 %s 的 precision 配置有误：%s", topic.Name, topic.Precision)
+		}
+
+		if mapping := topic.Mapping; mapping != nil {
+			if mapping.Measurement == "" {
+				return fmt.Errorf("主题 %s 的 mapping 缺少 measurement", topic.Name)
+			}
+
+			if len(mapping.Fields) == 0 && mapping.FieldsFrom == "" {
+				return fmt.Errorf("主题 %s 的 mapping 缺少 fields 或 fields_from", topic.Name)
+			}
+
+			if mapping.DbName == "" && topic.DbName == "" {
+				return fmt.Errorf("主题 %s 的 mapping 缺少 db_name", topic.Name)
+			}
+
+			if err := validateMapping(mapping); err != nil {
+				return fmt.Errorf("主题 %s 的 mapping 配置有误：%v", topic.Name, err)
+			}
+		}
+
+		if topic.Timestamp == nil {
+			continue
+		}
+
+		switch topic.Timestamp.EpochUnit {
+		case "", "auto", "s", "ms", "us", "ns":
+		default:
+			return fmt.Errorf("主题 %s 的 epoch_unit 配置有误：%s", topic.Name, topic.Timestamp.EpochUnit)
+		}
+
+		if _, err := time.LoadLocation(topic.Timestamp.Timezone); err != nil {
+			return fmt.Errorf("主题 %s 的 timezone 配置有误：%v", topic.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestResolveInfluxConfigValidatesMapping(t *testing.T) {
+	defer func() {
+		config.Topics = nil
+		config.Influx = nil
+	}()
+
+	tests := []struct {
+		name    string
+		mapping PointMapping
+		valid   bool
+	}{
+		{"合法", PointMapping{Measurement: "$.name", Explode: "$.metrics[*]", Fields: map[string]string{"value": "@.value"}}, true},
+		{"字段选择器有误", PointMapping{Measurement: "cpu", Fields: map[string]string{"value": "$.values[x]"}}, false},
+		{"标签选择器有误", PointMapping{Measurement: "cpu", Tags: map[string]string{"host": "$.host["}, Fields: map[string]string{"value": "$.v"}}, false},
+		{"explode 有误", PointMapping{Measurement: "cpu", Explode: "$..metrics", Fields: map[string]string{"value": "@.v"}}, false},
+		{"时间戳有误", PointMapping{Measurement: "cpu", Timestamp: "$ts", Fields: map[string]string{"value": "$.v"}}, false},
+	}
+
+	for _, tt := range tests {
+		mapping := tt.mapping
+		config.Influx = nil
+		config.Topics = []TopicConfig{{Name: "metrics", DbName: "venusdb", Mapping: &mapping}}
+		if err := resolveInfluxConfig(); (err == nil) != tt.valid {
+			t.Errorf("%s：%v，期望合法：%v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"strings"
 )
 
@@ -14,17 +15,51 @@ type MysqlDbConfig struct {
 	Port string
 	User string
 	Pwd  string
+	// Hosts 备用地址 host:port，故障切换时按顺序排在 Host:Port 之后
+	Hosts []string
+	Tls   MysqlTlsConfig
 }
+
+// Addresses 按优先级返回所有候选地址，去除重复
+func (c MysqlDbConfig) Addresses() []string {
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, address := range append([]string{net.JoinHostPort(c.Host, c.Port)}, c.Hosts...) {
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
 type VenusDataConfig struct {
 	KafkaBrokers []string
 	InfluxDb     InfluxDbConfig
 	MysqlDb      MysqlDbConfig
+	// MysqlEndpoints 包含默认实例在内的所有 MySQL 实例
+	MysqlEndpoints map[string]MysqlDbConfig
 }
 
 type Config struct {
-	content *VenusDataConfig
-	Base    *BaseConfig
-	Topics  []TopicConfig
+	content        *VenusDataConfig
+	Base           *BaseConfig
+	Topics         []TopicConfig
+	MysqlRetention *RetentionConfig
+	MysqlBulkLoad  []BulkLoadRule
+	Mysql          *MysqlDsnConfig
+	MysqlEndpoints map[string]MysqlEndpointConfig
+	MysqlRoutes    []MysqlRoute
+
+	MysqlShardSets     map[string]MysqlShardSet
+	MysqlShardedTables []MysqlShardedTable
+	MysqlPartitions    *PartitionConfig
+
+	Influx           *InfluxConfig
+	InfluxFieldRules []InfluxFieldRule
+	InfluxRollups    []InfluxRollupRule
+	InfluxTagLimits  []InfluxTagLimit
 }
 
 var config = &Config{}
@@ -43,22 +78,39 @@ func Init(kafka string, mysql string, influx string) error {
 		Host: influxDbConfig[0], Port: influxDbConfig[1],
 	}
 
-	mysqlFull := strings.Split(mysql, "@")
-	if mysqlFull == nil || len(mysqlFull) != 2 {
-		return fmt.Errorf("mysql 配置有误：%v", mysql)
+	if err := resolveInfluxConfig(); err != nil {
+		return err
+	}
+
+	mysqlDb, err := parseMysqlArg(mysql)
+	if err != nil {
+		return err
+	}
+
+	err = resolveMysqlCredentials(&mysqlDb, GetMysqlDsnConfig().MysqlCredentials)
+	if err != nil {
+		return err
+	}
+
+	mysqlDb.Tls = GetMysqlDsnConfig().MysqlTlsConfig
+	if err := validateMysqlTls(mysqlDb.Tls); err != nil {
+		return err
+	}
+
+	conf.MysqlDb = mysqlDb
+	conf.MysqlEndpoints, err = resolveMysqlEndpoints(mysqlDb)
+	if err != nil {
+		return err
 	}
 
-	mysqlIpCfg := strings.Split(mysqlFull[0], ":")
-	mysqlPwdCfg := strings.Split(mysqlFull[1], "/")
-	if mysqlIpCfg == nil || len(mysqlIpCfg) != 2 || mysqlPwdCfg == nil || len(mysqlPwdCfg) != 2 {
-		return fmt.Errorf("mysql 配置有误：%v", mysql)
+	err = validateMysqlPartitions()
+	if err != nil {
+		return err
 	}
 
-	conf.MysqlDb = MysqlDbConfig{
-		Host: mysqlIpCfg[0],
-		Port: mysqlIpCfg[1],
-		User: mysqlPwdCfg[0],
-		Pwd:  mysqlPwdCfg[1],
+	err = validateMysqlBulkLoad()
+	if err != nil {
+		return err
 	}
 
 	config.content = conf
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+)
+
+// DefaultMysqlEndpoint 命令行 -mysql 指定的实例
+const DefaultMysqlEndpoint = "default"
+
+// MysqlCredentials 账号及密码来源，密码按 PasswordFile、PasswordEnv、Password 的顺序取第一个配置的
+type MysqlCredentials struct {
+	User         string `json:"user"`
+	Password     string `json:"password"`
+	PasswordFile string `json:"password_file"`
+	PasswordEnv  string `json:"password_env"`
+}
+
+func (c MysqlCredentials) empty() bool {
+	return c.User == "" && c.Password == "" && c.PasswordFile == "" && c.PasswordEnv == ""
+}
+
+// MysqlTlsConfig TLS 参数，Tls 取值 false、true、skip-verify、preferred，
+// 设置 CaFile 时用该 CA 校验服务端证书，Tls 为 false 时不使用 TLS
+type MysqlTlsConfig struct {
+	Tls        string `json:"tls"`
+	CaFile     string `json:"ca_file"`
+	ServerName string `json:"server_name"`
+}
+
+func (c MysqlTlsConfig) empty() bool {
+	return c.Tls == "" && c.CaFile == "" && c.ServerName == ""
+}
+
+// MysqlEndpointConfig 具名的 MySQL 实例，未配置账号或 TLS 参数时沿用默认实例的配置
+type MysqlEndpointConfig struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
+	// Hosts 备用地址 host:port，主库不可写时依次切换
+	Hosts []string `json:"hosts"`
+	MysqlCredentials
+	MysqlTlsConfig
+}
+
+// MysqlRoute 库名匹配 Db 通配时写入 Endpoint 实例
+type MysqlRoute struct {
+	Db       string `json:"db"`
+	Endpoint string `json:"endpoint"`
+}
+
+// MysqlDsnConfig 连接参数，对应配置文件中的 mysql 块，时间单位为秒
+type MysqlDsnConfig struct {
+	MysqlCredentials
+	MysqlTlsConfig
+
+	Timeout      int    `json:"timeout"`
+	ReadTimeout  int    `json:"read_timeout"`
+	WriteTimeout int    `json:"write_timeout"`
+	Charset      string `json:"charset"`
+	Collation    string `json:"collation"`
+	ParseTime    bool   `json:"parse_time"`
+	Loc          string `json:"loc"`
+
+	// Params 其他 DSN 参数，原样传给驱动
+	Params map[string]string `json:"params"`
+}
+
+func GetMysqlDsnConfig() MysqlDsnConfig {
+	if config.Mysql == nil {
+		return MysqlDsnConfig{}
+	}
+
+	return *config.Mysql
+}
+
+// parseMysqlArg 解析 host:port[,host:port...][@user/password]，密码中可以包含 / 和 @，
+// 逗号分隔的其余地址为故障切换的备用地址
+func parseMysqlArg(mysql string) (MysqlDbConfig, error) {
+	address, credentials, hasCredentials := strings.Cut(mysql, "@")
+
+	addresses := strings.Split(address, ",")
+	host, port, ok := strings.Cut(addresses[0], ":")
+	if !ok || host == "" || port == "" {
+		return MysqlDbConfig{}, fmt.Errorf("mysql 配置有误：%v", address)
+	}
+
+	if err := validateMysqlHosts(addresses[1:]); err != nil {
+		return MysqlDbConfig{}, err
+	}
+
+	conf := MysqlDbConfig{Host: host, Port: port, Hosts: addresses[1:]}
+	if hasCredentials {
+		user, pwd, ok := strings.Cut(credentials, "/")
+		if !ok || user == "" {
+			return MysqlDbConfig{}, fmt.Errorf("mysql 用户配置有误：%v@%v/***", address, user)
+		}
+
+		conf.User = user
+		conf.Pwd = pwd
+	}
+
+	return conf, nil
+}
+
+// resolveMysqlCredentials 命令行未提供账号时，依次从密码文件、环境变量和配置文件读取
+func resolveMysqlCredentials(conf *MysqlDbConfig, creds MysqlCredentials) error {
+	if conf.User == "" {
+		conf.User = creds.User
+	}
+
+	if conf.Pwd != "" {
+		return nil
+	}
+
+	switch {
+	case creds.PasswordFile != "":
+		content, err := os.ReadFile(creds.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("读取 mysql 密码文件失败：%v", err)
+		}
+
+		conf.Pwd = strings.TrimRight(string(content), "\r\n")
+	case creds.PasswordEnv != "":
+		pwd, ok := os.LookupEnv(creds.PasswordEnv)
+		if !ok {
+			return fmt.Errorf("环境变量 %s 未设置", creds.PasswordEnv)
+		}
+
+		conf.Pwd = pwd
+	default:
+		conf.Pwd = creds.Password
+	}
+
+	if conf.User == "" {
+		return fmt.Errorf("未配置 mysql 用户")
+	}
+
+	return nil
+}
+
+// resolveMysqlEndpoints 解析具名实例的账号并检查路由引用的实例是否存在
+func resolveMysqlEndpoints(defaultDb MysqlDbConfig) (map[string]MysqlDbConfig, error) {
+	endpoints := map[string]MysqlDbConfig{DefaultMysqlEndpoint: defaultDb}
+	for name, endpoint := range config.MysqlEndpoints {
+		if name == DefaultMysqlEndpoint {
+			return nil, fmt.Errorf("mysql 实例名 %s 为保留名称", name)
+		}
+
+		if endpoint.Host == "" || endpoint.Port == "" {
+			return nil, fmt.Errorf("mysql 实例 %s 缺少 host/port", name)
+		}
+
+		if err := validateMysqlHosts(endpoint.Hosts); err != nil {
+			return nil, fmt.Errorf("mysql 实例 %s：%v", name, err)
+		}
+
+		conf := MysqlDbConfig{Host: endpoint.Host, Port: endpoint.Port, Hosts: endpoint.Hosts, Tls: defaultDb.Tls}
+		if !endpoint.MysqlTlsConfig.empty() {
+			if err := validateMysqlTls(endpoint.MysqlTlsConfig); err != nil {
+				return nil, fmt.Errorf("mysql 实例 %s：%v", name, err)
+			}
+
+			conf.Tls = endpoint.MysqlTlsConfig
+		}
+
+		if endpoint.MysqlCredentials.empty() {
+			conf.User = defaultDb.User
+			conf.Pwd = defaultDb.Pwd
+		} else if err := resolveMysqlCredentials(&conf, endpoint.MysqlCredentials); err != nil {
+			return nil, fmt.Errorf("mysql 实例 %s：%v", name, err)
+		}
+
+		endpoints[name] = conf
+	}
+
+	for _, route := range config.MysqlRoutes {
+		if _, ok := endpoints[route.Endpoint]; !ok {
+			return nil, fmt.Errorf("mysql 路由 %s 引用了不存在的实例 %s", route.Db, route.Endpoint)
+		}
+	}
+
+	if err := validateMysqlShards(endpoints); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+func validateMysqlHosts(hosts []string) error {
+	for _, address := range hosts {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || host == "" || port == "" {
+			return fmt.Errorf("mysql 备用地址有误：%v", address)
+		}
+	}
+
+	return nil
+}
+
+// validateMysqlTls 检查 TLS 模式，驱动遇到未注册的名称要到连接时才报错
+func validateMysqlTls(tls MysqlTlsConfig) error {
+	switch tls.Tls {
+	case "", "false", "true", "skip-verify", "preferred":
+		return nil
+	}
+
+	return fmt.Errorf("mysql tls 取值有误：%s", tls.Tls)
+}
+
+// ResolveMysqlEndpoint 按路由表为库名选择实例，没有匹配的路由时使用默认实例
+func ResolveMysqlEndpoint(dbName string) (string, MysqlDbConfig) {
+	conf := Get()
+	for _, route := range config.MysqlRoutes {
+		if matched, _ := path.Match(route.Db, dbName); matched {
+			return route.Endpoint, conf.MysqlEndpoints[route.Endpoint]
+		}
+	}
+
+	return DefaultMysqlEndpoint, conf.MysqlDb
+}
+
+// MysqlShardSet 分片集合，PreviousEndpoints 为迁移前的分片，配置后新旧分片双写
+type MysqlShardSet struct {
+	Endpoints         []string `json:"endpoints"`
+	PreviousEndpoints []string `json:"previous_endpoints"`
+	VirtualNodes      int      `json:"virtual_nodes"`
+}
+
+// MysqlShardedTable 匹配的表按 Key 列的一致性哈希写入 ShardSet 中的实例
+type MysqlShardedTable struct {
+	Db       string `json:"db"`
+	Table    string `json:"table"`
+	ShardSet string `json:"shard_set"`
+	Key      string `json:"key"`
+}
+
+func GetMysqlShardSets() map[string]MysqlShardSet {
+	return config.MysqlShardSets
+}
+
+func GetMysqlShardedTables() []MysqlShardedTable {
+	return config.MysqlShardedTables
+}
+
+// validateMysqlShards 检查分片配置引用的实例和分片集合是否存在
+func validateMysqlShards(endpoints map[string]MysqlDbConfig) error {
+	for name, set := range config.MysqlShardSets {
+		if len(set.Endpoints) == 0 {
+			return fmt.Errorf("mysql 分片集合 %s 没有实例", name)
+		}
+
+		for _, endpoint := range append(append([]string{}, set.Endpoints...), set.PreviousEndpoints...) {
+			if _, ok := endpoints[endpoint]; !ok {
+				return fmt.Errorf("mysql 分片集合 %s 引用了不存在的实例 %s", name, endpoint)
+			}
+		}
+	}
+
+	for _, table := range config.MysqlShardedTables {
+		if _, ok := config.MysqlShardSets[table.ShardSet]; !ok {
+			return fmt.Errorf("mysql 分片表 %s.%s 引用了不存在的分片集合 %s", table.Db, table.Table, table.ShardSet)
+		}
+
+		if table.Key == "" {
+			return fmt.Errorf("mysql 分片表 %s.%s 未配置分片键", table.Db, table.Table)
+		}
+	}
+
+	return nil
+}
+
+// validateMysqlBulkLoad 检查批量导入规则的模式，模式有误的规则会导致每次写入都失败
+func validateMysqlBulkLoad() error {
+	for _, rule := range GetMysqlBulkLoadRules() {
+		switch strings.ToLower(rule.Mode) {
+		case "replace", "ignore":
+		default:
+			return fmt.Errorf("mysql 批量导入 %s.%s 的模式有误：%s", rule.Db, rule.Table, rule.Mode)
+		}
+	}
+
+	return nil
+}
+
+// validateMysqlPartitions 检查分区规则的模式和时间单位
+func validateMysqlPartitions() error {
+	for _, rule := range GetMysqlPartitionConfig().Rules {
+		if rule.Mode != "range" && rule.Mode != "suffix" {
+			return fmt.Errorf("mysql 分区表 %s.%s 的模式有误：%s", rule.Db, rule.Table, rule.Mode)
+		}
+
+		if rule.Unit != "" && rule.Unit != "day" && rule.Unit != "month" {
+			return fmt.Errorf("mysql 分区表 %s.%s 的时间单位有误：%s", rule.Db, rule.Table, rule.Unit)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import "testing"
+
+func TestValidateMysqlBulkLoad(t *testing.T) {
+	defer func() {
+		config.MysqlBulkLoad = nil
+	}()
+
+	tests := []struct {
+		mode  string
+		valid bool
+	}{
+		{"replace", true},
+		{"IGNORE", true},
+		{"", false},
+		{"upsert", false},
+	}
+
+	for _, tt := range tests {
+		config.MysqlBulkLoad = []BulkLoadRule{{Db: "metrics", Table: "*", Mode: tt.mode}}
+		if err := validateMysqlBulkLoad(); (err == nil) != tt.valid {
+			t.Errorf("mode %q：%v，期望合法：%v", tt.mode, err, tt.valid)
+		}
+	}
+}
+
+func TestResolveMysqlEndpointsTls(t *testing.T) {
+	defer func() {
+		config.MysqlEndpoints = nil
+	}()
+
+	defaultTls := MysqlTlsConfig{Tls: "true", CaFile: "/etc/venus/a.pem"}
+	config.MysqlEndpoints = map[string]MysqlEndpointConfig{
+		"inherit":  {Host: "10.0.0.1", Port: "3306"},
+		"override": {Host: "10.0.0.2", Port: "3306", MysqlTlsConfig: MysqlTlsConfig{Tls: "preferred", CaFile: "/etc/venus/b.pem"}},
+	}
+
+	endpoints, err := resolveMysqlEndpoints(MysqlDbConfig{Host: "10.0.0.3", Port: "3306", User: "u", Tls: defaultTls})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if endpoints["inherit"].Tls != defaultTls {
+		t.Errorf("未沿用默认实例的 TLS 参数：%+v", endpoints["inherit"].Tls)
+	}
+
+	if endpoints["override"].Tls.CaFile != "/etc/venus/b.pem" {
+		t.Errorf("未使用实例自己的 CA：%+v", endpoints["override"].Tls)
+	}
+
+	config.MysqlEndpoints = map[string]MysqlEndpointConfig{
+		"bad": {Host: "10.0.0.1", Port: "3306", MysqlTlsConfig: MysqlTlsConfig{Tls: "required"}},
+	}
+
+	if _, err = resolveMysqlEndpoints(MysqlDbConfig{Host: "10.0.0.3", Port: "3306", User: "u"}); err == nil {
+		t.Error("未拒绝无效的 tls 模式")
+	}
+}
+
+func TestResolveMysqlEndpoint(t *testing.T) {
+	defer func() {
+		config.MysqlEndpoints = nil
+		config.MysqlRoutes = nil
+	}()
+
+	config.MysqlEndpoints = map[string]MysqlEndpointConfig{
+		"metrics": {Host: "10.0.0.1", Port: "3306"},
+		"logs":    {Host: "10.0.0.2", Port: "3306"},
+		"archive": {Host: "10.0.0.3", Port: "3307", MysqlCredentials: MysqlCredentials{User: "archiver", Password: "secret"}},
+	}
+
+	// 按配置顺序匹配，先匹配的路由生效
+	config.MysqlRoutes = []MysqlRoute{
+		{Db: "metrics", Endpoint: "metrics"},
+		{Db: "log_*", Endpoint: "logs"},
+		{Db: "*_archive", Endpoint: "archive"},
+		{Db: "shard_[0-3]", Endpoint: "archive"},
+	}
+
+	if err := Init("127.0.0.1:9092", "127.0.0.1:3306@venus/pwd", "127.0.0.1:8086"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		db       string
+		endpoint string
+		host     string
+		user     string
+	}{
+		{db: "metrics", endpoint: "metrics", host: "10.0.0.1", user: "venus"},
+		{db: "log_app", endpoint: "logs", host: "10.0.0.2", user: "venus"},
+		{db: "log_archive", endpoint: "logs", host: "10.0.0.2", user: "venus"},
+		{db: "user_archive", endpoint: "archive", host: "10.0.0.3", user: "archiver"},
+		{db: "shard_2", endpoint: "archive", host: "10.0.0.3", user: "archiver"},
+		{db: "shard_4", endpoint: DefaultMysqlEndpoint, host: "127.0.0.1", user: "venus"},
+		{db: "metrics_v2", endpoint: DefaultMysqlEndpoint, host: "127.0.0.1", user: "venus"},
+		{db: "logs", endpoint: DefaultMysqlEndpoint, host: "127.0.0.1", user: "venus"},
+	}
+
+	for _, tt := range tests {
+		endpoint, conf := ResolveMysqlEndpoint(tt.db)
+		if endpoint != tt.endpoint || conf.Host != tt.host || conf.User != tt.user {
+			t.Errorf("%s：实例 %s（%s@%s），期望 %s（%s@%s）", tt.db, endpoint, conf.User, conf.Host, tt.endpoint, tt.user, tt.host)
+		}
+	}
+}
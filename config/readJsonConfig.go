@@ -12,16 +12,94 @@ type BaseConfig struct {
 	MysqlMaxIntervalTime int    `json:"mysql_max_interval_time"`
 	MysqlPoolChannelSize uint32 `json:"mysql_pool_channel_size"`
 
+	// 每个数据库共用一个 sql.DB，以下为其连接池参数，时间单位为秒
+	MysqlMaxOpenConns    int `json:"mysql_max_open_conns"`
+	MysqlMaxIdleConns    int `json:"mysql_max_idle_conns"`
+	MysqlConnMaxLifetime int `json:"mysql_conn_max_lifetime"`
+	MysqlConnMaxIdleTime int `json:"mysql_conn_max_idle_time"`
+	// 全进程 MySQL 连接上限，0 表示不限制
+	MysqlMaxTotalConns int `json:"mysql_max_total_conns"`
+	// 连接池空闲超过该时间（秒）后关闭，0 表示不关闭
+	MysqlPoolIdleTimeout int `json:"mysql_pool_idle_timeout"`
+	// 配置了备用地址时，每隔该时间（秒）检查当前主库是否仍可写，默认 10
+	MysqlHealthCheckInterval int `json:"mysql_health_check_interval"`
+	// 所有地址都不可写时，重新探测的退避上限（秒），默认 60
+	MysqlReconnectBackoffMax int `json:"mysql_reconnect_backoff_max"`
+	// 连接正常但写入失败时的最大重试次数，超过后整批转入失败处理，默认 10
+	MysqlFlushMaxRetries int `json:"mysql_flush_max_retries"`
+
+	// 为 true 时写入前按消息中的新列执行 ALTER TABLE ADD COLUMN，默认不修改表结构，带有未知列的行转入失败处理
+	MysqlAddColumns bool `json:"mysql_add_columns"`
+
+	// 库名、表名、列名的校验规则，为空时使用默认规则
+	MysqlIdentifierPattern   string `json:"mysql_identifier_pattern"`
+	MysqlIdentifierMaxLength int    `json:"mysql_identifier_max_length"`
+
 	InfluxPoolSize        uint32 `json:"influx_pool_size"`
 	InfluxMaxBufferSize   int    `json:"influx_max_buffer_size"`
 	InfluxMaxIntervalTime int    `json:"influx_max_interval_time"`
 	InfluxPoolChannelSize uint32 `json:"influx_pool_channel_size"`
+
+	// 指标服务监听地址，如 :9100，为空时不启动
+	MetricsAddr string `json:"metrics_addr"`
+}
+
+// RetentionRule 按库名、表名通配匹配，Ttl 为 0 表示不清理
+type RetentionRule struct {
+	Db     string `json:"db"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Ttl    int    `json:"ttl"`
+}
+
+type RetentionConfig struct {
+	Interval  int             `json:"interval"`
+	ChunkSize int             `json:"chunk_size"`
+	Rules     []RetentionRule `json:"rules"`
 }
+
+// BulkLoadRule 匹配的表在一批不少于 MinRows 行时改用 LOAD DATA LOCAL INFILE，Mode 为 replace 或 ignore
+type BulkLoadRule struct {
+	Db      string `json:"db"`
+	Table   string `json:"table"`
+	Mode    string `json:"mode"`
+	MinRows int    `json:"min_rows"`
+}
+
+// PartitionRule 按时间分区的表。Mode 为 range 时使用 MySQL RANGE 分区，为 suffix 时按时间写入 table_20261016 这样的分表；
+// Unit 为 day 或 month，Ahead 为提前创建的分区数，Ttl 为保留时间（秒），0 表示不删除
+type PartitionRule struct {
+	Db     string `json:"db"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Mode   string `json:"mode"`
+	Unit   string `json:"unit"`
+	Ahead  int    `json:"ahead"`
+	Ttl    int    `json:"ttl"`
+}
+
+type PartitionConfig struct {
+	Interval int             `json:"interval"`
+	Rules    []PartitionRule `json:"rules"`
+}
+
 type TopicConfig struct {
 	Name        string `json:"name"`
 	GroupID     string `json:"group_id"`
 	StorageType string `json:"storage_type"`
 	ConsumeNum  int    `json:"consume_num"`
+
+	// Timestamp influx 主题的时间戳解析规则，为空时使用默认规则
+	Timestamp *TimestampConfig `json:"timestamp"`
+
+	// 以下用于 influx_lineprotocol 主题：消息头 db_name 未提供时写入 DbName，
+	// Tags 追加到每个点，Precision 为行中时间戳的精度，默认 ns
+	DbName    string            `json:"db_name"`
+	Tags      map[string]string `json:"tags"`
+	Precision string            `json:"precision"`
+
+	// Mapping influxdb 主题按规则把任意 JSON 映射为点，为空时消息须为 WriteMessage
+	Mapping *PointMapping `json:"mapping"`
 }
 
 func LoadConfigFromFile(filename string) error {
@@ -31,8 +109,21 @@ func LoadConfigFromFile(filename string) error {
 	}
 
 	var fileConfig struct {
-		Base   BaseConfig    `json:"base"`
-		Topics []TopicConfig `json:"topics"`
+		Base           BaseConfig                     `json:"base"`
+		Topics         []TopicConfig                  `json:"topics"`
+		MysqlRetention RetentionConfig                `json:"mysql_retention"`
+		MysqlBulkLoad  []BulkLoadRule                 `json:"mysql_bulk_load"`
+		Mysql          MysqlDsnConfig                 `json:"mysql"`
+		MysqlEndpoints map[string]MysqlEndpointConfig `json:"mysql_endpoints"`
+		MysqlRoutes    []MysqlRoute                   `json:"mysql_routes"`
+
+		MysqlShardSets     map[string]MysqlShardSet `json:"mysql_shard_sets"`
+		MysqlShardedTables []MysqlShardedTable      `json:"mysql_sharded_tables"`
+		MysqlPartitions    PartitionConfig          `json:"mysql_partitions"`
+		Influx             InfluxConfig             `json:"influx"`
+		InfluxFieldRules   []InfluxFieldRule        `json:"influx_field_rules"`
+		InfluxRollups      []InfluxRollupRule       `json:"influx_rollups"`
+		InfluxTagLimits    []InfluxTagLimit         `json:"influx_tag_limits"`
 		VenusDataConfig
 	}
 
@@ -43,6 +134,18 @@ func LoadConfigFromFile(filename string) error {
 
 	config.Base = &fileConfig.Base
 	config.Topics = fileConfig.Topics
+	config.MysqlRetention = &fileConfig.MysqlRetention
+	config.MysqlBulkLoad = fileConfig.MysqlBulkLoad
+	config.Mysql = &fileConfig.Mysql
+	config.MysqlEndpoints = fileConfig.MysqlEndpoints
+	config.MysqlRoutes = fileConfig.MysqlRoutes
+	config.MysqlShardSets = fileConfig.MysqlShardSets
+	config.MysqlShardedTables = fileConfig.MysqlShardedTables
+	config.MysqlPartitions = &fileConfig.MysqlPartitions
+	config.Influx = &fileConfig.Influx
+	config.InfluxFieldRules = fileConfig.InfluxFieldRules
+	config.InfluxRollups = fileConfig.InfluxRollups
+	config.InfluxTagLimits = fileConfig.InfluxTagLimits
 	config.content = &fileConfig.VenusDataConfig
 	return nil
 }
@@ -54,3 +157,23 @@ func GetBaseConfig() BaseConfig {
 func GetTopicsConfig() []TopicConfig {
 	return config.Topics
 }
+
+func GetMysqlRetentionConfig() RetentionConfig {
+	if config.MysqlRetention == nil {
+		return RetentionConfig{}
+	}
+
+	return *config.MysqlRetention
+}
+
+func GetMysqlPartitionConfig() PartitionConfig {
+	if config.MysqlPartitions == nil {
+		return PartitionConfig{}
+	}
+
+	return *config.MysqlPartitions
+}
+
+func GetMysqlBulkLoadRules() []BulkLoadRule {
+	return config.MysqlBulkLoad
+}
@@ -0,0 +1,131 @@
+package influx
+
+import (
+	log "github.com/my-dev-lib/pretty-log-go"
+	"path"
+	"sync"
+	"time"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const defaultTagLimitWindow = 3600
+
+// tagValues 一个标签在当前窗口内已记录的值，最多 limit 个，超出后只记录是否已告警；窗口结束后清空
+type tagValues struct {
+	values   map[string]struct{}
+	exceeded bool
+	resetAt  time.Time
+}
+
+var tagCardinality = make(map[string]*tagValues)
+var tagCardinalityLock = sync.Mutex{}
+var tagCardinalityLog = log.NewLog("ITC")
+
+// tagCardinalitySweepAt 之后清理已过期的标签，避免不再出现的 measurement 一直占用内存
+var tagCardinalitySweepAt time.Time
+
+func tagLimit(measurement string, tag string) *config.InfluxTagLimit {
+	limits := config.GetInfluxTagLimits()
+	for i := range limits {
+		if matched, _ := path.Match(limits[i].Measurement, measurement); !matched {
+			continue
+		}
+
+		if matched, _ := path.Match(limits[i].Tag, tag); matched {
+			return &limits[i]
+		}
+	}
+
+	return nil
+}
+
+func tagLimitWindow(limit *config.InfluxTagLimit) time.Duration {
+	if limit.Window <= 0 {
+		return defaultTagLimitWindow * time.Second
+	}
+
+	return time.Duration(limit.Window) * time.Second
+}
+
+// admit 值已记录或未达到上限时返回 true
+func admit(db string, measurement string, tag string, value string, limit *config.InfluxTagLimit, now time.Time) bool {
+	key := db + "\x00" + measurement + "\x00" + tag
+	window := tagLimitWindow(limit)
+
+	tagCardinalityLock.Lock()
+	defer tagCardinalityLock.Unlock()
+
+	sweepTagCardinality(now, window)
+
+	values, ok := tagCardinality[key]
+	if !ok || !now.Before(values.resetAt) {
+		values = &tagValues{values: make(map[string]struct{}), resetAt: now.Add(window)}
+		tagCardinality[key] = values
+	}
+
+	if _, ok := values.values[value]; ok {
+		return true
+	}
+
+	if len(values.values) < limit.Limit {
+		values.values[value] = struct{}{}
+		return true
+	}
+
+	if !values.exceeded {
+		values.exceeded = true
+		tagCardinalityLog.W("标签基数超过限制 %s.%s.%s：%d，示例值：%s", db, measurement, tag, limit.Limit, value)
+	}
+
+	return false
+}
+
+// sweepTagCardinality 每隔 interval 删除窗口已结束的标签，调用方持有 tagCardinalityLock
+func sweepTagCardinality(now time.Time, interval time.Duration) {
+	if now.Before(tagCardinalitySweepAt) {
+		return
+	}
+
+	for key, values := range tagCardinality {
+		if !now.Before(values.resetAt) {
+			delete(tagCardinality, key)
+		}
+	}
+
+	tagCardinalitySweepAt = now.Add(interval)
+	metrics.Set("influx_tag_limit_tracked", int64(len(tagCardinality)))
+}
+
+// guardTags 按 influx_tag_limits 处理超出上限的标签值，点被丢弃时返回 false。
+// 指标按规则而不是按 measurement 区分，避免指标本身的基数失控
+func guardTags(db string, point *Point) bool {
+	if len(config.GetInfluxTagLimits()) == 0 {
+		return true
+	}
+
+	now := time.Now()
+	for tag, value := range point.Tags {
+		limit := tagLimit(point.Measurement, tag)
+		if limit == nil || admit(db, point.Measurement, tag, value, limit, now) {
+			continue
+		}
+
+		metrics.Add("influx_tag_limit_exceeded", 1)
+		metrics.Add("influx_tag_limit_exceeded."+limit.Measurement+"."+limit.Tag, 1)
+
+		switch limit.Action {
+		case "reject":
+			return false
+		case "demote_to_field":
+			// 与已有字段同名时保留原字段
+			if _, ok := point.Fields[tag]; !ok {
+				point.Fields[tag] = value
+			}
+		}
+
+		delete(point.Tags, tag)
+	}
+
+	return true
+}
@@ -0,0 +1,112 @@
+package influx
+
+import (
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+	"venu-data/config"
+)
+
+func resetTagCardinality(t *testing.T) {
+	t.Helper()
+
+	tagCardinalityLock.Lock()
+	tagCardinality = make(map[string]*tagValues)
+	tagCardinalitySweepAt = time.Time{}
+	tagCardinalityLock.Unlock()
+}
+
+func counter(name string) int64 {
+	counters := expvar.Get("venus_data").(*expvar.Map).Get("counters").(*expvar.Map)
+	if v, ok := counters.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
+
+func TestAdmitResetsAfterWindow(t *testing.T) {
+	resetTagCardinality(t)
+	limit := &config.InfluxTagLimit{Measurement: "*", Tag: "id", Limit: 2, Action: "drop_tag", Window: 60}
+	now := time.Unix(1700000000, 0)
+
+	for _, value := range []string{"a", "b"} {
+		if !admit("db", "cpu", "id", value, limit, now) {
+			t.Fatalf("未达到上限时应接受：%s", value)
+		}
+	}
+
+	if admit("db", "cpu", "id", "c", limit, now.Add(59*time.Second)) {
+		t.Fatal("超出上限时应拒绝")
+	}
+
+	if !admit("db", "cpu", "id", "a", limit, now.Add(59*time.Second)) {
+		t.Fatal("已记录的值应接受")
+	}
+
+	if !admit("db", "cpu", "id", "c", limit, now.Add(60*time.Second)) {
+		t.Fatal("窗口结束后应重新计数")
+	}
+
+	tagCardinalityLock.Lock()
+	values := tagCardinality["db\x00cpu\x00id"]
+	tagCardinalityLock.Unlock()
+	if len(values.values) != 1 || values.exceeded {
+		t.Errorf("窗口结束后未清空：%d 个值，已告警：%v", len(values.values), values.exceeded)
+	}
+}
+
+func TestAdmitSweepsExpiredTags(t *testing.T) {
+	resetTagCardinality(t)
+	limit := &config.InfluxTagLimit{Measurement: "*", Tag: "id", Limit: 10, Action: "drop_tag", Window: 60}
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 100; i++ {
+		admit("db", fmt.Sprintf("m%d", i), "id", "a", limit, now)
+	}
+
+	admit("db", "cpu", "id", "a", limit, now.Add(2*time.Minute))
+
+	tagCardinalityLock.Lock()
+	defer tagCardinalityLock.Unlock()
+	if len(tagCardinality) != 1 {
+		t.Errorf("过期的标签未清理：%d", len(tagCardinality))
+	}
+}
+
+func TestGuardTagsMetricUsesRule(t *testing.T) {
+	loadTestConfig(t, "127.0.0.1:8086", map[string]any{
+		"influx_tag_limits": []map[string]any{
+			{"measurement": "req_*", "tag": "id", "limit": 1, "action": "drop_tag"},
+		},
+	})
+	resetTagCardinality(t)
+
+	before := counter("influx_tag_limit_exceeded.req_*.id")
+	for i := 0; i < 3; i++ {
+		point := &Point{
+			Measurement: fmt.Sprintf("req_%d", i),
+			Tags:        map[string]string{"id": "x"},
+			Fields:      map[string]any{"value": 1},
+		}
+
+		if !guardTags("db", point) {
+			t.Fatal("drop_tag 不应丢弃点")
+		}
+	}
+
+	point := &Point{Measurement: "req_0", Tags: map[string]string{"id": "y"}, Fields: map[string]any{"value": 1}}
+	guardTags("db", point)
+	if _, ok := point.Tags["id"]; ok {
+		t.Error("超出上限的标签未去掉")
+	}
+
+	if got := counter("influx_tag_limit_exceeded.req_*.id") - before; got != 1 {
+		t.Errorf("按规则计数：%d，期望：1", got)
+	}
+
+	if counter("influx_tag_limit_exceeded.req_0.id") != 0 {
+		t.Error("不应按 measurement 生成指标")
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"errors"
 	"fmt"
 	log "github.com/my-dev-lib/pretty-log-go"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"venu-data/config"
 
+	"github.com/influxdata/influxdb1-client/models"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
@@ -22,6 +25,34 @@ type Point struct {
 	Tags        map[string]string `json:"tags"`
 	Fields      map[string]any    `json:"fields"`
 	Timestamp   time.Time         `json:"timestamp"`
+
+	// raw 已校验的行协议点，设置时原样写入，Tags 和 Fields 为空
+	raw models.Point
+}
+
+// fieldType 字段在行协议中的类型名，字段不存在时返回 false
+func (p Point) fieldType(name string) (string, bool) {
+	if p.raw == nil {
+		value, ok := p.Fields[name]
+		return fieldType(value), ok
+	}
+
+	iterator := p.raw.FieldIterator()
+	for iterator.Next() {
+		if string(iterator.FieldKey()) == name {
+			return rawFieldTypes[iterator.Type()], true
+		}
+	}
+
+	return "", false
+}
+
+var rawFieldTypes = map[models.FieldType]string{
+	models.Float:    "float",
+	models.Integer:  "integer",
+	models.Unsigned: "unsigned",
+	models.String:   "string",
+	models.Boolean:  "boolean",
 }
 
 type Client struct {
@@ -29,9 +60,10 @@ type Client struct {
 	status   atomic.Uint32
 	lock     sync.Mutex
 
-	database string
-	host     string
-	port     string
+	database        string
+	retentionPolicy string
+	host            string
+	port            string
 
 	debug bool
 	log   *log.Log
@@ -54,31 +86,81 @@ func (dc *Client) init(database string, host string, port string, debug bool) {
 }
 
 func (dc *Client) connect() error {
-	url := fmt.Sprintf("http://%s:%s", dc.host, dc.port)
-	c, err := client.NewHTTPClient(client.HTTPConfig{Addr: url, Timeout: 1 * time.Minute})
+	tlsConfig, err := loadTlsConfig()
+	if err != nil {
+		return err
+	}
+
+	conf := config.GetInfluxConfig()
+	c, err := client.NewHTTPClient(client.HTTPConfig{
+		Addr:      baseUrl(dc.host, dc.port),
+		Username:  conf.Username,
+		Password:  conf.Password,
+		TLSConfig: tlsConfig,
+		Timeout:   1 * time.Minute,
+	})
 	dc.dbClient = c
 	if err != nil {
-		fmt.Print(err)
 		return err
 	}
 
 	return nil
 }
 
+// batchPointsConfig 写入的库、精度、保留策略和一致性级别
+func (dc *Client) batchPointsConfig() client.BatchPointsConfig {
+	conf := config.GetInfluxConfig()
+	retentionPolicy := dc.retentionPolicy
+	if retentionPolicy == "" {
+		retentionPolicy = conf.RetentionPolicy
+	}
+
+	return client.BatchPointsConfig{
+		Database:         dc.database,
+		Precision:        v1Precision(),
+		RetentionPolicy:  retentionPolicy,
+		WriteConsistency: conf.WriteConsistency,
+	}
+}
+
+// v1Precision 1.x 接口的微秒写作 u，而客户端按 time.ParseDuration 校验精度只接受 us，
+// 因此微秒精度按纳秒写入，时间戳由 v1Timestamp 截断到微秒
+func v1Precision() string {
+	if precision := writePrecision(); precision != "us" {
+		return precision
+	}
+
+	return "ns"
+}
+
+func v1Timestamp(t time.Time) time.Time {
+	if writePrecision() == "us" {
+		return t.Truncate(time.Microsecond)
+	}
+
+	return t
+}
+
 func (dc *Client) ensureDatabase() error {
+	if config.GetInfluxConfig().SkipCreateDatabase {
+		return nil
+	}
+
 	//noinspection ALL
-	q := client.NewQuery("create database "+dc.database, "", "")
+	q := client.NewQuery("create database "+quoteIdentifier(dc.database), "", "")
 	var c = dc.dbClient
-	if response, err := c.Query(q); err == nil && response.Error() == nil {
-		if dc.debug {
-			dc.log.I("数据库创建成功 %s", dc.database)
-		}
-	} else {
-		if dc.debug {
-			dc.log.I("数据库创建失败：", err.Error())
-		}
+	response, err := c.Query(q)
+	if err == nil {
+		err = response.Error()
+	}
+
+	if err != nil {
+		// 账号没有管理员权限时可配置 skip_create_database
+		return fmt.Errorf("创建数据库失败：%s：%v", dc.database, err)
+	}
 
-		return fmt.Errorf("创建数据库失败：%s", dc.database)
+	if dc.debug {
+		dc.log.I("数据库创建成功 %s", dc.database)
 	}
 
 	return nil
@@ -128,13 +210,22 @@ func (dc *Client) Init() error {
 	}
 }
 
+// WriteBatch 按各点自身的时间戳写入，时间戳为空的点使用当前时间
 func (dc *Client) WriteBatch(records *[]Point) error {
-	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{Database: dc.database})
-	// 重置时间，避免重复
-	startTime := time.Now()
+	bp, _ := client.NewBatchPoints(dc.batchPointsConfig())
 	for _, r := range *records {
-		p, err := client.NewPoint(r.Measurement, r.Tags, r.Fields, startTime)
-		startTime.Add(time.Duration(1))
+		if r.raw != nil {
+			r.raw.SetTime(v1Timestamp(r.raw.Time()))
+			bp.AddPoint(client.NewPointFrom(r.raw))
+			continue
+		}
+
+		timestamp := r.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+
+		p, err := client.NewPoint(r.Measurement, r.Tags, r.Fields, v1Timestamp(timestamp))
 		if err != nil {
 			return err
 		}
@@ -157,8 +248,8 @@ func (dc *Client) WriteBatch(records *[]Point) error {
 func (dc *Client) Write(measurement string, tags map[string]string,
 	fields map[string]any, timestamp time.Time) error {
 
-	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{Database: dc.database})
-	p, err := client.NewPoint(measurement, tags, fields, timestamp)
+	bp, _ := client.NewBatchPoints(dc.batchPointsConfig())
+	p, err := client.NewPoint(measurement, tags, fields, v1Timestamp(timestamp))
 	if err != nil {
 		return err
 	}
@@ -175,3 +266,8 @@ func (dc *Client) Write(measurement string, tags map[string]string,
 
 	return nil
 }
+
+// quoteIdentifier InfluxQL 双引号标识符
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(name, `\`, `\\`), `"`, `\"`) + `"`
+}
@@ -0,0 +1,243 @@
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const defaultFieldSeparator = "_"
+
+var errNoFields = errors.New("没有有效字段")
+
+// fieldRule 返回 measurement 匹配的第一条字段规则，未配置时返回 nil
+func fieldRule(measurement string) *config.InfluxFieldRule {
+	rules := config.GetInfluxFieldRules()
+	for i := range rules {
+		if matched, _ := path.Match(rules[i].Measurement, measurement); matched {
+			return &rules[i]
+		}
+	}
+
+	return nil
+}
+
+// normalizeFields 转换为 InfluxDB 支持的字段：展开嵌套、去掉 nil、转换无符号整数，并按规则强制类型。
+// 无法转换的字段被丢弃并计数，没有剩余字段时返回 errNoFields
+func normalizeFields(measurement string, fields map[string]any) (map[string]any, error) {
+	rule := fieldRule(measurement)
+	separator := defaultFieldSeparator
+	if rule != nil && rule.Separator != "" {
+		separator = rule.Separator
+	}
+
+	normalized := make(map[string]any, len(fields))
+	flattenFields(normalized, "", separator, fields)
+
+	for name, value := range normalized {
+		fieldType := forcedType(rule, name)
+		if fieldType == "" {
+			continue
+		}
+
+		converted, err := convertField(value, fieldType)
+		if err != nil {
+			delete(normalized, name)
+			metrics.Add("influx_field_conversion_errors", 1)
+			continue
+		}
+
+		normalized[name] = converted
+	}
+
+	if len(normalized) == 0 {
+		return nil, errNoFields
+	}
+
+	return normalized, nil
+}
+
+func flattenFields(dst map[string]any, prefix string, separator string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			flattenFields(dst, joinFieldName(prefix, separator, key), separator, child)
+		}
+	case []any:
+		for i, child := range v {
+			flattenFields(dst, joinFieldName(prefix, separator, strconv.Itoa(i)), separator, child)
+		}
+	case nil:
+	case uint64:
+		// 超出 int64 范围时只能转为浮点数
+		if v > math.MaxInt64 {
+			dst[prefix] = float64(v)
+		} else {
+			dst[prefix] = int64(v)
+		}
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			dst[prefix] = float64(v)
+		} else {
+			dst[prefix] = int64(v)
+		}
+	default:
+		dst[prefix] = v
+	}
+}
+
+func joinFieldName(prefix string, separator string, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + separator + key
+}
+
+func forcedType(rule *config.InfluxFieldRule, name string) string {
+	if rule == nil {
+		return ""
+	}
+
+	fieldType, _ := lookupPattern(rule.Fields, name)
+	return fieldType
+}
+
+// lookupPattern 字段名精确匹配优先，其次按通配的字典序匹配
+func lookupPattern[T any](patterns map[string]T, name string) (T, bool) {
+	if value, ok := patterns[name]; ok {
+		return value, true
+	}
+
+	keys := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		keys = append(keys, pattern)
+	}
+
+	sort.Strings(keys)
+	for _, pattern := range keys {
+		if matched, _ := path.Match(pattern, name); matched {
+			return patterns[pattern], true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+func convertField(value any, fieldType string) (any, error) {
+	switch fieldType {
+	case "int":
+		return toInt(value)
+	case "float":
+		return toFloat(value)
+	case "string":
+		return toString(value), nil
+	case "bool":
+		return toBool(value)
+	default:
+		return value, nil
+	}
+}
+
+func toInt(value any) (int64, error) {
+	switch v := value.(type) {
+	case float64:
+		// math.MaxInt64 转为浮点数后是 2^63，本身已超出 int64，因此用 >= 比较
+		rounded := math.Round(v)
+		if math.IsNaN(v) || rounded >= math.MaxInt64 || rounded < math.MinInt64 {
+			return 0, fmt.Errorf("超出整数范围：%v", v)
+		}
+
+		return int64(rounded), nil
+	case float32:
+		return toInt(float64(v))
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+
+		return 0, nil
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return n, nil
+		}
+
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		return toInt(f)
+	default:
+		return 0, fmt.Errorf("无法转换为整数：%T", value)
+	}
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("无法转换为浮点数：%T", value)
+	}
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toBool(value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(v))
+	default:
+		f, err := toFloat(value)
+		if err != nil {
+			return false, fmt.Errorf("无法转换为布尔值：%T", value)
+		}
+
+		return f != 0, nil
+	}
+}
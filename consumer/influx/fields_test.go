@@ -0,0 +1,111 @@
+package influx
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestToInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  int64
+		ok    bool
+	}{
+		{"四舍五入", 12.5, 13, true},
+		{"负数", -12.5, -13, true},
+		{"字符串", " 42 ", 42, true},
+		{"浮点字符串", "12.4", 12, true},
+		{"布尔", true, 1, true},
+		{"最小值", float64(math.MinInt64), math.MinInt64, true},
+		{"2^63", math.Pow(2, 63), 0, false},
+		{"超出下限", -math.Pow(2, 63) * 2, 0, false},
+		{"NaN", math.NaN(), 0, false},
+		{"正无穷", math.Inf(1), 0, false},
+		{"负无穷", math.Inf(-1), 0, false},
+		{"非数字", "abc", 0, false},
+		{"不支持的类型", []any{1}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toInt(tt.value)
+			if (err == nil) != tt.ok {
+				t.Fatalf("toInt(%v) 错误：%v", tt.value, err)
+			}
+
+			if tt.ok && got != tt.want {
+				t.Errorf("toInt(%v) = %d，期望 %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeFields(t *testing.T) {
+	loadTestConfig(t, "127.0.0.1:8086", map[string]any{
+		"influx_field_rules": []map[string]any{
+			{"measurement": "interface", "fields": map[string]any{"*_octets": "int", "status": "string", "up": "bool"}},
+			{"measurement": "sensor", "fields": map[string]any{"*": "float"}, "separator": "."},
+		},
+	})
+
+	tests := []struct {
+		name        string
+		measurement string
+		fields      map[string]any
+		want        map[string]any
+		err         error
+	}{
+		{
+			name:        "无符号整数",
+			measurement: "cpu",
+			fields:      map[string]any{"small": uint64(7), "large": uint64(math.MaxUint64), "plain": uint(3)},
+			want:        map[string]any{"small": int64(7), "large": float64(math.MaxUint64), "plain": int64(3)},
+		},
+		{
+			name:        "嵌套对象和数组",
+			measurement: "cpu",
+			fields:      map[string]any{"load": map[string]any{"avg": 1.5, "cores": []any{0.5, 2.5}}, "empty": nil},
+			want:        map[string]any{"load_avg": 1.5, "load_cores_0": 0.5, "load_cores_1": 2.5},
+		},
+		{
+			name:        "自定义分隔符",
+			measurement: "sensor",
+			fields:      map[string]any{"temp": map[string]any{"inner": "21.5"}},
+			want:        map[string]any{"temp.inner": 21.5},
+		},
+		{
+			name:        "强制类型",
+			measurement: "interface",
+			fields:      map[string]any{"in_octets": 1024.4, "status": 1.0, "up": "true"},
+			want:        map[string]any{"in_octets": int64(1024), "status": "1", "up": true},
+		},
+		{
+			name:        "超出整数范围",
+			measurement: "interface",
+			fields:      map[string]any{"in_octets": math.Pow(2, 63), "out_octets": math.NaN(), "status": "up"},
+			want:        map[string]any{"status": "up"},
+		},
+		{
+			name:        "没有剩余字段",
+			measurement: "interface",
+			fields:      map[string]any{"in_octets": "abc", "empty": nil},
+			err:         errNoFields,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeFields(tt.measurement, tt.fields)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("错误：%v，期望 %v", err, tt.err)
+			}
+
+			if tt.err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("字段：%v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
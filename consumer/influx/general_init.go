@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	pretty_log "github.com/my-dev-lib/pretty-log-go"
-	"time"
 	"venu-data/config"
 	"venu-data/consumer/base"
 )
@@ -27,20 +26,34 @@ type DataMessage struct {
 
 // 实现接口的结构体
 type ReaderConsumer struct {
-	log     *pretty_log.Log
-	topic   string
-	groupId string
-	id      string
+	log        *pretty_log.Log
+	topic      string
+	groupId    string
+	id         string
+	timestamps *timestampDecoder
+	// mapper 配置了 mapping 时使用，mapperErr 为规则编译错误
+	mapper    *pointMapper
+	mapperErr error
 }
 
 // 构造函数，用于初始化 WriteConsumer2 并设置初始值
 func NewInfluxReaderConsumer(topicConf config.TopicConfig) *ReaderConsumer {
-	return &ReaderConsumer{
-		log:     pretty_log.NewLog("IIC"),
-		topic:   topicConf.Name,
-		groupId: topicConf.GroupID,
-		id:      topicConf.GroupID + "_" + uuid.New().String(),
+	rc := &ReaderConsumer{
+		log:        pretty_log.NewLog("IIC"),
+		topic:      topicConf.Name,
+		groupId:    topicConf.GroupID,
+		id:         topicConf.GroupID + "_" + uuid.New().String(),
+		timestamps: newTimestampDecoder(topicConf.Timestamp),
 	}
+
+	if topicConf.Mapping != nil {
+		rc.mapper, rc.mapperErr = newPointMapper(topicConf.Mapping, topicConf.DbName)
+		if rc.mapperErr != nil {
+			rc.log.E("主题 %s 的 mapping 配置有误：%v", topicConf.Name, rc.mapperErr)
+		}
+	}
+
+	return rc
 }
 
 func (rc *ReaderConsumer) Topic() string {
@@ -55,19 +68,55 @@ func (rc *ReaderConsumer) Id() string {
 	return rc.id
 }
 
-func (rc *ReaderConsumer) handlePlus(dbName string, msg *WriteMessage) {
-	pool := obtainPool(dbName)
+func (rc *ReaderConsumer) handlePlus(dbName string, msg *WriteMessage, dataMsg *base.DataMessage) error {
+	t, err := rc.timestamps.resolve(msg.Timestamp, dataMsg)
+	if err != nil {
+		return err
+	}
 
-	t, _ := time.Parse(time.RFC3339Nano, msg.Timestamp)
-	err := pool.writeToInfluxDb(msg.Measurement, msg.Tags, msg.Fields, t)
+	fields, err := normalizeFields(msg.Measurement, msg.Fields)
+	if err != nil {
+		return fmt.Errorf("%s：%v", msg.Measurement, err)
+	}
+
+	pool := obtainPool(dbName)
+	err = pool.writeToInfluxDb(msg.Measurement, msg.Tags, fields, t)
 	if err != nil {
 		rc.log.W("写入 influxdb 失败：%v", err)
 	}
+
+	return nil
+}
+
+// consumeMapped 按 mapping 转换消息，一条消息可能生成多个点
+func (rc *ReaderConsumer) consumeMapped(msg *base.DataMessage) error {
+	if rc.mapperErr != nil {
+		return fmt.Errorf("mapping 配置有误：%v", rc.mapperErr)
+	}
+
+	messages, err := rc.mapper.mapMessage(msg.Value)
+	if err != nil {
+		return fmt.Errorf("json 解析错误：%v", err)
+	}
+
+	var firstErr error
+	for i := range messages {
+		err = rc.handlePlus(messages[i].DbName, &messages[i], msg)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
 }
 
 func (rc *ReaderConsumer) Consume(msg *base.DataMessage) error {
 	// ic.log.D("influx.WriteConsumer 开始消费：%v", string(msg.Value))
 
+	if rc.mapper != nil || rc.mapperErr != nil {
+		return rc.consumeMapped(msg)
+	}
+
 	var iwMsg WriteMessage
 	err := json.Unmarshal(msg.Value, &iwMsg)
 
@@ -75,6 +124,5 @@ func (rc *ReaderConsumer) Consume(msg *base.DataMessage) error {
 		return fmt.Errorf("json 解析错误：%v", err)
 	}
 
-	rc.handlePlus(iwMsg.DbName, &iwMsg)
-	return nil
+	return rc.handlePlus(iwMsg.DbName, &iwMsg, msg)
 }
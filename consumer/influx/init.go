@@ -21,37 +21,83 @@ var sharedDbPool = make(map[string]*Pool)
 var poolLock = sync.Mutex{}
 
 func obtainPool(dbName string) *Pool {
+	return obtainRetentionPool(dbName, "")
+}
+
+// obtainRetentionPool 写入指定保留策略的连接池，用于聚合结果
+func obtainRetentionPool(dbName string, retentionPolicy string) *Pool {
 	poolLock.Lock()
 	defer poolLock.Unlock()
 
-	pool, ok := sharedDbPool[dbName]
+	key := dbName
+	if retentionPolicy != "" {
+		key = dbName + "/" + retentionPolicy
+	}
+
+	pool, ok := sharedDbPool[key]
 	if !ok {
 		cfg := config.Get().InfluxDb
-		pool = NewPool(config.GetBaseConfig().InfluxPoolSize, dbName, cfg.Host, cfg.Port, false)
-		sharedDbPool[dbName] = pool
+		pool = newRetentionPool(config.GetBaseConfig().InfluxPoolSize, dbName, retentionPolicy, cfg.Host, cfg.Port, false)
+		sharedDbPool[key] = pool
 	}
 
 	return pool
 }
 
+// Close 停止前调用：先输出所有未结束的聚合窗口，再写完各连接池缓冲的数据。
+// 聚合结果可能写入保留策略连接池，因此最后关闭这些连接池
+func Close() {
+	poolLock.Lock()
+	var pools []*Pool
+	for _, pool := range sharedDbPool {
+		pools = append(pools, pool)
+	}
+	poolLock.Unlock()
+
+	for _, pool := range pools {
+		pool.emitRollups(time.Now(), true)
+	}
+
+	poolLock.Lock()
+	var retentionPools []*Pool
+	for _, pool := range sharedDbPool {
+		if pool.retentionPolicy != "" {
+			retentionPools = append(retentionPools, pool)
+		}
+	}
+	poolLock.Unlock()
+
+	for _, pool := range pools {
+		if pool.retentionPolicy == "" {
+			pool.close()
+		}
+	}
+
+	for _, pool := range retentionPools {
+		pool.close()
+	}
+}
+
 type WriteMessage struct {
 	DbName      string            `json:"db_name"`
 	Measurement string            `json:"measurement"`
 	Tags        map[string]string `json:"tags"`
 	Fields      map[string]any    `json:"fields"`
-	Timestamp   string            `json:"timestamp"`
+	Timestamp   Timestamp         `json:"timestamp"`
 }
 
 type WriteConsumer struct {
-	log *prettyLog.Log
-	id  string
+	log        *prettyLog.Log
+	id         string
+	timestamps *timestampDecoder
 }
 
 func NewSwitchWriteConsumer() *WriteConsumer {
 	return &WriteConsumer{
 		log: prettyLog.NewLog("IIC"),
 		//id:  topicWriteGroupId + "_" + fmt.Sprintf("%d", time.Now().Nanosecond()),
-		id: topicWriteGroupId + "_" + uuid.New().String(),
+		id:         topicWriteGroupId + "_" + uuid.New().String(),
+		timestamps: newTimestampDecoder(nil),
 	}
 }
 
@@ -66,14 +112,24 @@ func (ic *WriteConsumer) Topic() string {
 	return topicWrite
 }
 
-func (ic *WriteConsumer) handle(dbName string, msg *WriteMessage) {
-	pool := obtainPool(dbName)
+func (ic *WriteConsumer) handle(dbName string, msg *WriteMessage, dataMsg *base.DataMessage) error {
+	t, err := ic.timestamps.resolve(msg.Timestamp, dataMsg)
+	if err != nil {
+		return err
+	}
 
-	t, _ := time.Parse(time.RFC3339Nano, msg.Timestamp)
-	err := pool.writeToInfluxDb(msg.Measurement, msg.Tags, msg.Fields, t)
+	fields, err := normalizeFields(msg.Measurement, msg.Fields)
+	if err != nil {
+		return fmt.Errorf("%s：%v", msg.Measurement, err)
+	}
+
+	pool := obtainPool(dbName)
+	err = pool.writeToInfluxDb(msg.Measurement, msg.Tags, fields, t)
 	if err != nil {
 		ic.log.W("写入 influxdb 失败：%v", err)
 	}
+
+	return nil
 }
 
 func (ic *WriteConsumer) Consume(msg *base.DataMessage) error {
@@ -86,6 +142,5 @@ func (ic *WriteConsumer) Consume(msg *base.DataMessage) error {
 		return fmt.Errorf("json 解析错误：%v", err)
 	}
 
-	ic.handle(iwMsg.DbName, &iwMsg)
-	return nil
+	return ic.handle(iwMsg.DbName, &iwMsg, msg)
 }
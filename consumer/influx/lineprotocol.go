@@ -0,0 +1,131 @@
+package influx
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	prettyLog "github.com/my-dev-lib/pretty-log-go"
+	"strings"
+	"venu-data/config"
+	"venu-data/consumer/base"
+	"venu-data/internal/metrics"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// dbNameHeader 指定行协议消息写入的库
+const dbNameHeader = "db_name"
+
+// LineProtocolConsumer 消息内容为一行或多行 InfluxDB 行协议，解析校验后交给 Pool 批量写入
+type LineProtocolConsumer struct {
+	log       *prettyLog.Log
+	topic     string
+	groupId   string
+	id        string
+	dbName    string
+	tags      map[string]string
+	precision string
+}
+
+func NewLineProtocolConsumer(topicConf config.TopicConfig) *LineProtocolConsumer {
+	precision := topicConf.Precision
+	if precision == "" {
+		precision = defaultPrecision
+	}
+
+	return &LineProtocolConsumer{
+		log:       prettyLog.NewLog("ILP"),
+		topic:     topicConf.Name,
+		groupId:   topicConf.GroupID,
+		id:        topicConf.GroupID + "_" + uuid.New().String(),
+		dbName:    topicConf.DbName,
+		tags:      topicConf.Tags,
+		precision: pointPrecision(precision),
+	}
+}
+
+func (lc *LineProtocolConsumer) Topic() string {
+	return lc.topic
+}
+
+func (lc *LineProtocolConsumer) GroupId() string {
+	return lc.groupId
+}
+
+func (lc *LineProtocolConsumer) Id() string {
+	return lc.id
+}
+
+// targetDb 消息头优先，其次为主题配置
+func (lc *LineProtocolConsumer) targetDb(msg *base.DataMessage) string {
+	for _, header := range msg.Headers {
+		if header.Key == dbNameHeader && len(header.Value) > 0 {
+			return string(header.Value)
+		}
+	}
+
+	return lc.dbName
+}
+
+// invalidLines 解析失败的行数，ParsePointsWithPrecision 把每个失败的行写成一条 unable to parse，以换行分隔
+func invalidLines(err error) int64 {
+	if err == nil {
+		return 0
+	}
+
+	return int64(strings.Count(err.Error(), "\nunable to parse '") + 1)
+}
+
+// passthrough 没有附加标签和字段规则，且连接池不做标签限制和聚合时，行协议点原样转发，不再解码后重新编码
+func (lc *LineProtocolConsumer) passthrough(pool *Pool, point models.Point) bool {
+	return len(lc.tags) == 0 && pool.acceptsRaw() && fieldRule(string(point.Name())) == nil
+}
+
+// Consume 无效的行被跳过并按行计数，其余行照常写入
+func (lc *LineProtocolConsumer) Consume(msg *base.DataMessage) error {
+	dbName := lc.targetDb(msg)
+	if dbName == "" {
+		return fmt.Errorf("#LineProtocolConsumer.Consume 未指定 db_name")
+	}
+
+	points, parseErr := models.ParsePointsWithPrecision(msg.Value, fallbackTimestamp(msg), lc.precision)
+	if parseErr != nil {
+		metrics.Add("influx_invalid_lines", invalidLines(parseErr))
+	}
+
+	pool := obtainPool(dbName)
+	for _, point := range points {
+		if lc.passthrough(pool, point) {
+			pool.send(Point{Measurement: string(point.Name()), Timestamp: point.Time(), raw: point})
+			continue
+		}
+
+		fields, err := point.Fields()
+		if err != nil {
+			metrics.Add("influx_invalid_lines", 1)
+			continue
+		}
+
+		measurement := string(point.Name())
+		normalized, err := normalizeFields(measurement, fields)
+		if err != nil {
+			metrics.Add("influx_invalid_lines", 1)
+			continue
+		}
+
+		tags := point.Tags().Map()
+		for k, v := range lc.tags {
+			tags[k] = v
+		}
+
+		err = pool.writeToInfluxDb(measurement, tags, normalized, point.Time())
+		if err != nil {
+			lc.log.W("写入 influxdb 失败：%v", err)
+		}
+	}
+
+	if parseErr != nil {
+		return fmt.Errorf("#LineProtocolConsumer.Consume 行协议解析错误：%v", parseErr)
+	}
+
+	return nil
+}
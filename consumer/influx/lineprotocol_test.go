@@ -0,0 +1,130 @@
+package influx
+
+import (
+	"net/http"
+	"testing"
+	"time"
+	"venu-data/config"
+	"venu-data/consumer/base"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestInvalidLinesCountsEachLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		valid   int
+		invalid int64
+	}{
+		{"全部有效", "cpu usage=1\n# 注释\n\nmem used=2i\n", 2, 0},
+		{"一行无效", "cpu usage=1\ncpu usage=\n", 1, 1},
+		{"多行无效", "cpu usage=\nbad\ncpu usage=1\ncpu,host=a\n", 1, 3},
+	}
+
+	for _, tt := range tests {
+		points, err := models.ParsePointsWithPrecision([]byte(tt.payload), time.Now(), "ns")
+		if len(points) != tt.valid {
+			t.Errorf("%s：有效 %d 行，期望 %d 行", tt.name, len(points), tt.valid)
+		}
+
+		if got := invalidLines(err); got != tt.invalid {
+			t.Errorf("%s：无效 %d 行，期望 %d 行", tt.name, got, tt.invalid)
+		}
+	}
+}
+
+func TestLineProtocolPassthrough(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]any
+		tags      map[string]string
+		rollups   []*rollup
+		line      string
+		want      bool
+	}{
+		{"无加工", nil, nil, nil, "cpu,host=a usage=1.5", true},
+		{"附加标签", nil, map[string]string{"site": "bj"}, nil, "cpu,host=a usage=1.5", false},
+		{"字段规则", map[string]any{"influx_field_rules": []map[string]any{{"measurement": "cpu", "fields": map[string]string{"usage": "float"}}}}, nil, nil, "cpu,host=a usage=1.5", false},
+		{"其他表的字段规则", map[string]any{"influx_field_rules": []map[string]any{{"measurement": "mem", "fields": map[string]string{"used": "float"}}}}, nil, nil, "cpu,host=a usage=1.5", true},
+		{"标签限制", map[string]any{"influx_tag_limits": []map[string]any{{"measurement": "*", "tag": "host", "limit": 10, "action": "reject"}}}, nil, nil, "cpu,host=a usage=1.5", false},
+		{"聚合", nil, nil, []*rollup{{}}, "cpu,host=a usage=1.5", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, "127.0.0.1:8086", tt.overrides)
+
+			points, err := models.ParsePointsWithPrecision([]byte(tt.line), time.Now(), "ns")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lc := &LineProtocolConsumer{tags: tt.tags}
+			if got := lc.passthrough(&Pool{rollups: tt.rollups}, points[0]); got != tt.want {
+				t.Errorf("原样转发：%v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestV2WriteRawLines 原样转发的行不经过解码，写入内容与输入一致
+func TestV2WriteRawLines(t *testing.T) {
+	server, requests := newV2Server(t, http.StatusNoContent, "")
+	c := newTestV2Client(t, server, map[string]any{"precision": "ms"}, "")
+
+	payload := "cpu,host=a\\ b,rack=r1 usage=1.5,state=\"ok\",up=true,count=3i 1700000000123\n"
+	parsed, err := models.ParsePointsWithPrecision([]byte(payload), time.Now(), "ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := []Point{{Measurement: "cpu", Timestamp: parsed[0].Time(), raw: parsed[0]}}
+	if err = c.WriteBatch(&points); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := <-requests; r.body != payload {
+		t.Errorf("请求内容：%s期望：%s", r.body, payload)
+	}
+
+	conflict := &typeConflict{field: "count", measurement: "cpu", existType: "float"}
+	if !conflict.matches(points[0]) {
+		t.Error("原样转发的点应能按字段类型定位冲突")
+	}
+}
+
+// 行中的时间戳按主题配置的精度解析
+func TestLineProtocolPrecision(t *testing.T) {
+	tests := []struct {
+		precision string
+		line      string
+		want      time.Time
+	}{
+		{precision: "", line: "cpu usage=1.5 1700000000123456789", want: time.Unix(testEpoch, 123456789)},
+		{precision: "ns", line: "cpu usage=1.5 1700000000123456789", want: time.Unix(testEpoch, 123456789)},
+		{precision: "us", line: "cpu usage=1.5 1700000000123456", want: time.Unix(testEpoch, 123456000)},
+		{precision: "ms", line: "cpu usage=1.5 1700000000123", want: time.Unix(testEpoch, 123000000)},
+		{precision: "s", line: "cpu usage=1.5 1700000000", want: time.Unix(testEpoch, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			loadTestConfig(t, "127.0.0.1:8086", nil)
+			writer := &recordWriter{}
+			idp := newTestPool(t, writer)
+
+			lc := NewLineProtocolConsumer(config.TopicConfig{Name: "lp", DbName: idp.db, Precision: tt.precision})
+			if err := lc.Consume(&base.DataMessage{Message: kafka.Message{Value: []byte(tt.line)}}); err != nil {
+				t.Fatal(err)
+			}
+
+			idp.close()
+			points := writer.written()
+			if len(points) != 1 || !points[0].Timestamp.Equal(tt.want) {
+				t.Fatalf("写入的点有误：%v，期望时间 %s", points, tt.want)
+			}
+		})
+	}
+}
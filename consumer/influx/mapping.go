@@ -0,0 +1,191 @@
+package influx
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+	"venu-data/internal/selector"
+)
+
+// pointMapper 按主题的 mapping 配置把消息转换为 WriteMessage
+type pointMapper struct {
+	dbName      *selector.Selector
+	measurement *selector.Selector
+	explode     *selector.Selector
+	tags        map[string]*selector.Selector
+	fields      map[string]*selector.Selector
+	fieldsFrom  *selector.Selector
+	timestamp   *selector.Selector
+}
+
+func newPointMapper(conf *config.PointMapping, defaultDb string) (*pointMapper, error) {
+	var err error
+	compile := func(expr string) *selector.Selector {
+		if err != nil || expr == "" {
+			return nil
+		}
+
+		var s *selector.Selector
+		s, err = selector.Compile(expr)
+		return s
+	}
+
+	dbName := conf.DbName
+	if dbName == "" {
+		dbName = defaultDb
+	}
+
+	m := &pointMapper{
+		dbName:      compile(dbName),
+		measurement: compile(conf.Measurement),
+		explode:     compile(conf.Explode),
+		fieldsFrom:  compile(conf.FieldsFrom),
+		timestamp:   compile(conf.Timestamp),
+		tags:        make(map[string]*selector.Selector),
+		fields:      make(map[string]*selector.Selector),
+	}
+
+	for name, expr := range conf.Tags {
+		m.tags[name] = compile(expr)
+	}
+
+	for name, expr := range conf.Fields {
+		m.fields[name] = compile(expr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// mapMessage 配置了 explode 时每个展开的元素生成一个点，缺少 measurement 或字段的元素被跳过并计数
+func (m *pointMapper) mapMessage(value []byte) ([]WriteMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+
+	elements := []any{root}
+	if m.explode != nil {
+		elements = m.explode.SelectAll(root, root)
+	}
+
+	var messages []WriteMessage
+	for _, element := range elements {
+		msg := WriteMessage{
+			DbName:      m.selectString(m.dbName, root, element),
+			Measurement: m.selectString(m.measurement, root, element),
+			Tags:        make(map[string]string),
+			Fields:      make(map[string]any),
+		}
+
+		for name, s := range m.tags {
+			if tag := m.selectString(s, root, element); tag != "" {
+				msg.Tags[name] = tag
+			}
+		}
+
+		if m.fieldsFrom != nil {
+			if object, ok := m.fieldsFrom.SelectOne(root, element); ok {
+				if fields, ok := object.(map[string]any); ok {
+					for name, field := range fields {
+						msg.Fields[name] = plainValue(field)
+					}
+				}
+			}
+		}
+
+		for name, s := range m.fields {
+			if field, ok := s.SelectOne(root, element); ok {
+				msg.Fields[name] = plainValue(field)
+			}
+		}
+
+		if m.timestamp != nil {
+			if ts, ok := m.timestamp.SelectOne(root, element); ok {
+				msg.Timestamp = toTimestamp(ts)
+			}
+		}
+
+		if msg.DbName == "" || msg.Measurement == "" || len(msg.Fields) == 0 {
+			metrics.Add("influx_unmapped_points", 1)
+			continue
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (m *pointMapper) selectString(s *selector.Selector, root any, current any) string {
+	if s == nil {
+		return ""
+	}
+
+	value, ok := s.SelectOne(root, current)
+	if !ok {
+		return ""
+	}
+
+	return scalarString(value)
+}
+
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		content, _ := json.Marshal(v)
+		return string(content)
+	}
+}
+
+// plainValue 数字与 json.Unmarshal 的结果一致，转为 float64，需要整数时用 influx_field_rules 指定
+func plainValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+
+		return f
+	case map[string]any:
+		for key, child := range v {
+			v[key] = plainValue(child)
+		}
+
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = plainValue(child)
+		}
+
+		return v
+	default:
+		return v
+	}
+}
+
+func toTimestamp(value any) Timestamp {
+	switch v := value.(type) {
+	case json.Number:
+		return Timestamp{Value: v.String(), Number: true}
+	default:
+		return Timestamp{Value: scalarString(v)}
+	}
+}
@@ -0,0 +1,123 @@
+package influx
+
+import (
+	"fmt"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"regexp"
+	"venu-data/internal/metrics"
+)
+
+// 类型冲突时重发的最大次数，每次剔除一组冲突的点
+const maxConflictRetries = 10
+
+// RejectHandler 处理无法写入的点，默认仅记录日志
+type RejectHandler func(db string, point Point, err error)
+
+var rejectHandler RejectHandler = logRejected
+var rejectLog = log.NewLog("IR")
+
+func SetRejectHandler(handler RejectHandler) {
+	if handler == nil {
+		handler = logRejected
+	}
+
+	rejectHandler = handler
+}
+
+func logRejected(db string, point Point, err error) {
+	if point.raw != nil {
+		rejectLog.E("丢弃无法写入的数据 %s：%v, line: %s", db, err, point.raw.String())
+		return
+	}
+
+	rejectLog.E("丢弃无法写入的数据 %s.%s：%v, tags: %v, fields: %v", db, point.Measurement, err, point.Tags, point.Fields)
+}
+
+// 1.x 与 2.x 返回的错误中都包含这段文字
+var typeConflictPattern = regexp.MustCompile(
+	`field type conflict: input field \\?"(.+?)\\?" on measurement \\?"(.+?)\\?" is type (\w+), already exists as type (\w+)`)
+
+// typeConflict 写入时字段类型与库中已有类型不一致
+type typeConflict struct {
+	field       string
+	measurement string
+	inputType   string
+	existType   string
+}
+
+func (c *typeConflict) Error() string {
+	return fmt.Sprintf("字段类型冲突：%s.%s 为 %s，库中为 %s", c.measurement, c.field, c.inputType, c.existType)
+}
+
+func parseTypeConflict(err error) *typeConflict {
+	match := typeConflictPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return nil
+	}
+
+	return &typeConflict{field: match[1], measurement: match[2], inputType: match[3], existType: match[4]}
+}
+
+// matches 点的该字段类型与库中类型不同时才会冲突
+func (c *typeConflict) matches(point Point) bool {
+	if point.Measurement != c.measurement {
+		return false
+	}
+
+	inputType, ok := point.fieldType(c.field)
+	return ok && inputType != c.existType
+}
+
+// fieldType 与行协议中的类型名一致，见 models.appendField
+func fieldType(value any) string {
+	switch value.(type) {
+	case float64, float32:
+		return "float"
+	case uint64:
+		return "unsigned"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		return "integer"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	default:
+		return ""
+	}
+}
+
+// flush 写入缓冲区。遇到字段类型冲突时剔除冲突的点转入失败处理，其余点重新写入
+func (idp *Pool) flush(handler *Handler, buffer []Point) {
+	for attempt := 0; len(buffer) > 0; attempt++ {
+		err := handler.client.WriteBatch(&buffer)
+		if err == nil {
+			return
+		}
+
+		conflict := parseTypeConflict(err)
+		if conflict == nil || attempt >= maxConflictRetries {
+			idp.log.E("influxDbClient.Write: %v", err)
+			return
+		}
+
+		var kept []Point
+		for _, point := range buffer {
+			if conflict.matches(point) {
+				rejectHandler(idp.db, point, conflict)
+			} else {
+				kept = append(kept, point)
+			}
+		}
+
+		rejected := len(buffer) - len(kept)
+		if rejected == 0 {
+			idp.log.E("无法定位类型冲突的数据：%v", err)
+			return
+		}
+
+		metrics.Add("influx_type_conflicts", int64(rejected))
+		metrics.Add(fmt.Sprintf("influx_type_conflicts.%s.%s", conflict.measurement, conflict.field), int64(rejected))
+		idp.log.W("%s，剔除 %d 条后重新写入 %d 条", conflict.Error(), rejected, len(kept))
+		buffer = kept
+	}
+}
@@ -0,0 +1,290 @@
+package influx
+
+import (
+	"errors"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 1.x 部分写入失败时返回 400，响应体为 {"error": ...}
+const v1ConflictBody = `{"error":"partial write: field type conflict: input field \"usage\" on measurement \"cpu\" is type integer, already exists as type float dropped=1"}`
+
+// 2.x 部分写入失败时返回 422，响应体为 {"code": ..., "message": ...}
+const v2ConflictBody = `{"code":"unprocessable entity","message":"failure writing points to database: partial write: field type conflict: input field \"usage\" on measurement \"cpu\" is type integer, already exists as type float dropped=1"}`
+
+// writeResponse 测试服务对一次写入的应答
+type writeResponse struct {
+	status int
+	body   string
+}
+
+// newWriteServer 依次按 responses 应答写入请求，超出后返回 204，收到的请求写入返回的 channel
+func newWriteServer(t *testing.T, path string, responses ...writeResponse) (*httptest.Server, chan writeRequest) {
+	t.Helper()
+
+	requests := make(chan writeRequest, len(responses)+maxConflictRetries)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("请求路径有误：%s", r.URL.Path)
+		}
+
+		request, ok := readRequest(t, r)
+		if !ok {
+			return
+		}
+
+		select {
+		case requests <- request:
+		default:
+			t.Errorf("写入请求过多")
+		}
+
+		response := writeResponse{status: http.StatusNoContent}
+		if len(responses) > 0 {
+			response, responses = responses[0], responses[1:]
+		}
+
+		if response.body != "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+
+		w.WriteHeader(response.status)
+		_, _ = w.Write([]byte(response.body))
+	}))
+
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// newTestV1Client 连接测试服务的 1.x 客户端，influx 为 influx 配置
+func newTestV1Client(t *testing.T, server *httptest.Server, influx map[string]any) *Client {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loadTestConfig(t, host+":"+port, map[string]any{"influx": influx})
+	c := NewClient("metrics", host, port, false)
+	if err = c.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// captureRejectedPoints 替换失败处理，收集被剔除的点
+func captureRejectedPoints(t *testing.T) *[]Point {
+	t.Helper()
+
+	var rejected []Point
+	SetRejectHandler(func(db string, point Point, err error) {
+		var conflict *typeConflict
+		if !errors.As(err, &conflict) {
+			t.Errorf("剔除原因应为类型冲突：%v", err)
+		}
+
+		rejected = append(rejected, point)
+	})
+
+	t.Cleanup(func() {
+		SetRejectHandler(nil)
+	})
+
+	return &rejected
+}
+
+func TestParseTypeConflict(t *testing.T) {
+	cpuUsage := &typeConflict{field: "usage", measurement: "cpu", inputType: "integer", existType: "float"}
+	tests := []struct {
+		name string
+		err  error
+		want *typeConflict
+	}{
+		{
+			name: "1.x 客户端解析后的错误",
+			err:  errors.New(`partial write: field type conflict: input field "usage" on measurement "cpu" is type integer, already exists as type float dropped=1`),
+			want: cpuUsage,
+		},
+		{
+			name: "1.x 未解析的 JSON 响应体",
+			err:  errors.New(v1ConflictBody),
+			want: cpuUsage,
+		},
+		{
+			name: "2.x 写入错误",
+			err:  errors.New(`influx 写入失败（422 unprocessable entity）：failure writing points to database: partial write: field type conflict: input field "usage" on measurement "cpu" is type integer, already exists as type float dropped=1`),
+			want: cpuUsage,
+		},
+		{
+			name: "2.x 未解析的 JSON 响应体",
+			err:  errors.New(v2ConflictBody),
+			want: cpuUsage,
+		},
+		{
+			name: "名称含空格和逗号",
+			err:  errors.New(`partial write: field type conflict: input field "free space" on measurement "disk,io" is type string, already exists as type boolean dropped=3`),
+			want: &typeConflict{field: "free space", measurement: "disk,io", inputType: "string", existType: "boolean"},
+		},
+		{
+			name: "其他部分写入错误",
+			err:  errors.New(`partial write: points beyond retention policy dropped=2`),
+		},
+		{
+			name: "连接错误",
+			err:  errors.New(`Post "http://127.0.0.1:8086/write": dial tcp 127.0.0.1:8086: connect: connection refused`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseTypeConflict(test.err)
+			if test.want == nil {
+				if got != nil {
+					t.Fatalf("不应识别为类型冲突：%+v", *got)
+				}
+
+				return
+			}
+
+			if got == nil || *got != *test.want {
+				t.Fatalf("解析结果有误：%+v, 期望 %+v", got, *test.want)
+			}
+		})
+	}
+}
+
+// 经客户端写入后返回的错误同样能识别出类型冲突
+func TestParseTypeConflictFromClients(t *testing.T) {
+	want := typeConflict{field: "usage", measurement: "cpu", inputType: "integer", existType: "float"}
+
+	t.Run("1.x", func(t *testing.T) {
+		server, _ := newWriteServer(t, "/write", writeResponse{status: http.StatusBadRequest, body: v1ConflictBody})
+		points := testPoints()
+		err := newTestV1Client(t, server, map[string]any{"skip_create_database": true}).WriteBatch(&points)
+		if err == nil {
+			t.Fatal("写入应失败")
+		}
+
+		if got := parseTypeConflict(err); got == nil || *got != want {
+			t.Fatalf("解析结果有误：%+v, 错误：%v", got, err)
+		}
+	})
+
+	t.Run("2.x", func(t *testing.T) {
+		server, _ := newWriteServer(t, "/api/v2/write", writeResponse{status: http.StatusUnprocessableEntity, body: v2ConflictBody})
+		points := testPoints()
+		err := newTestV2Client(t, server, nil, "").WriteBatch(&points)
+		if err == nil {
+			t.Fatal("写入应失败")
+		}
+
+		if got := parseTypeConflict(err); got == nil || *got != want {
+			t.Fatalf("解析结果有误：%+v, 错误：%v", got, err)
+		}
+	})
+}
+
+func TestTypeConflictMatches(t *testing.T) {
+	conflict := &typeConflict{field: "usage", measurement: "cpu", inputType: "integer", existType: "float"}
+	tests := []struct {
+		name  string
+		point Point
+		want  bool
+	}{
+		{name: "类型不同", point: Point{Measurement: "cpu", Fields: map[string]any{"usage": int64(2)}}, want: true},
+		{name: "int 同为整数", point: Point{Measurement: "cpu", Fields: map[string]any{"usage": 2}}, want: true},
+		{name: "字符串", point: Point{Measurement: "cpu", Fields: map[string]any{"usage": "2"}}, want: true},
+		{name: "类型相同", point: Point{Measurement: "cpu", Fields: map[string]any{"usage": 1.5}}},
+		{name: "float32 同为浮点", point: Point{Measurement: "cpu", Fields: map[string]any{"usage": float32(1.5)}}},
+		{name: "其他表", point: Point{Measurement: "mem", Fields: map[string]any{"usage": int64(2)}}},
+		{name: "不含该字段", point: Point{Measurement: "cpu", Fields: map[string]any{"idle": int64(2)}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := conflict.matches(test.point); got != test.want {
+				t.Fatalf("matches = %v, 期望 %v", got, test.want)
+			}
+		})
+	}
+}
+
+// 类型冲突时只剔除冲突的点，其余点重新写入
+func TestFlushRetriesWithoutConflictingPoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		response writeResponse
+		client   func(t *testing.T, server *httptest.Server) pointWriter
+	}{
+		{
+			name:     "1.x",
+			path:     "/write",
+			response: writeResponse{status: http.StatusBadRequest, body: v1ConflictBody},
+			client: func(t *testing.T, server *httptest.Server) pointWriter {
+				return newTestV1Client(t, server, map[string]any{"skip_create_database": true})
+			},
+		},
+		{
+			name:     "2.x",
+			path:     "/api/v2/write",
+			response: writeResponse{status: http.StatusUnprocessableEntity, body: v2ConflictBody},
+			client: func(t *testing.T, server *httptest.Server) pointWriter {
+				return newTestV2Client(t, server, nil, "")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newWriteServer(t, test.path, test.response)
+			handler := &Handler{client: test.client(t, server)}
+			rejected := captureRejectedPoints(t)
+
+			idp := &Pool{db: "metrics", log: log.NewLog("IP")}
+			idp.flush(handler, testPoints())
+
+			if len(requests) != 2 {
+				t.Fatalf("应写入两次，实际 %d 次", len(requests))
+			}
+
+			first, second := (<-requests).body, (<-requests).body
+			if strings.Count(strings.TrimSpace(first), "\n") != 1 {
+				t.Fatalf("首次写入应包含全部点：%q", first)
+			}
+
+			if strings.Contains(second, "usage=2i") || !strings.Contains(second, "usage=1.5") {
+				t.Fatalf("重新写入应只包含浮点值的点：%q", second)
+			}
+
+			if len(*rejected) != 1 || (*rejected)[0].Fields["usage"] != int64(2) {
+				t.Fatalf("应只剔除整数值的点：%+v", *rejected)
+			}
+		})
+	}
+}
+
+// 冲突无法对应到任何点时不再重试
+func TestFlushStopsWhenConflictMatchesNothing(t *testing.T) {
+	server, requests := newWriteServer(t, "/api/v2/write", writeResponse{status: http.StatusUnprocessableEntity, body: v2ConflictBody})
+	handler := &Handler{client: newTestV2Client(t, server, nil, "")}
+	rejected := captureRejectedPoints(t)
+
+	points := []Point{testPoints()[0]}
+	idp := &Pool{db: "metrics", log: log.NewLog("IP")}
+	idp.flush(handler, points)
+
+	if len(requests) != 1 {
+		t.Fatalf("应只写入一次，实际 %d 次", len(requests))
+	}
+
+	if len(*rejected) != 0 {
+		t.Fatalf("不应剔除任何点：%+v", *rejected)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 	"venu-data/config"
+	"venu-data/internal/metrics"
 )
 
 const (
@@ -15,24 +16,35 @@ const (
 )
 
 type Handler struct {
-	client  *Client
+	client  pointWriter
 	channel chan Point
 }
 
 type Pool struct {
-	dbHandlers    []*Handler
-	currentIndex  int
-	lastWriteTime time.Time
-	handlerLock   sync.Mutex
-	db            string
-	host          string
-	port          string
-	debug         bool
-	log           *log.Log
+	dbHandlers      []*Handler
+	currentIndex    int
+	lastWriteTime   time.Time
+	handlerLock     sync.Mutex
+	db              string
+	retentionPolicy string
+	host            string
+	port            string
+	debug           bool
+	rollups         []*rollup
+	log             *log.Log
+
+	closed    bool
+	closeLock sync.RWMutex
+	stop      chan struct{}
+	stopped   sync.WaitGroup
 }
 
 func NewPool(poolSize uint32, dbname string, host string, port string, debug bool) *Pool {
-	idp := &Pool{dbHandlers: make([]*Handler, poolSize), db: dbname, host: host, port: port, debug: debug}
+	return newRetentionPool(poolSize, dbname, "", host, port, debug)
+}
+
+func newRetentionPool(poolSize uint32, dbname string, retentionPolicy string, host string, port string, debug bool) *Pool {
+	idp := &Pool{dbHandlers: make([]*Handler, poolSize), db: dbname, retentionPolicy: retentionPolicy, host: host, port: port, debug: debug, stop: make(chan struct{})}
 	idp.log = log.NewLog("IP")
 	idp.init()
 	return idp
@@ -41,15 +53,24 @@ func NewPool(poolSize uint32, dbname string, host string, port string, debug boo
 func (idp *Pool) init() {
 	idp.lastWriteTime = time.Now()
 	for i := 0; i < len(idp.dbHandlers); i++ {
-		client := NewClient(idp.db, idp.host, idp.port, idp.debug)
+		client := newPointWriter(idp.db, idp.retentionPolicy, idp.host, idp.port, idp.debug)
 
 		element := &Handler{
 			client: client, channel: make(chan Point, config.GetBaseConfig().InfluxPoolChannelSize),
 		}
 
 		idp.dbHandlers[i] = element
+		idp.stopped.Add(1)
 		go idp.handleInfluxDbChan(element)
 	}
+
+	// 聚合结果直接写入，不再参与聚合
+	if idp.retentionPolicy == "" {
+		idp.rollups = newRollups()
+		if len(idp.rollups) > 0 {
+			go idp.runRollups()
+		}
+	}
 }
 
 func (idp *Pool) obtainHandler() *Handler {
@@ -78,20 +99,76 @@ func (idp *Pool) writeToInfluxDb(measurement string, tags map[string]string,
 		copiedFields[k] = v
 	}
 
-	idp.obtainHandler().channel <- Point{
+	point := Point{
 		Measurement: measurement,
 		Tags:        copiedTags,
 		Fields:      copiedFields,
 		Timestamp:   timestamp,
 	}
 
+	if !guardTags(idp.db, &point) {
+		return nil
+	}
+
+	dropRaw := false
+	for _, r := range idp.rollups {
+		if r.add(point) && r.rule.DropRaw {
+			dropRaw = true
+		}
+	}
+
+	if !dropRaw {
+		idp.send(point)
+	}
+
 	return nil
 }
 
+// acceptsRaw 没有标签限制和聚合规则时，点不需要按字段加工，可以原样写入
+func (idp *Pool) acceptsRaw() bool {
+	return len(idp.rollups) == 0 && len(config.GetInfluxTagLimits()) == 0
+}
+
+// send 连接池关闭后丢弃并计数
+func (idp *Pool) send(point Point) {
+	idp.closeLock.RLock()
+	defer idp.closeLock.RUnlock()
+
+	if idp.closed {
+		metrics.Add("influx_dropped_points", 1)
+		return
+	}
+
+	idp.obtainHandler().channel <- point
+}
+
+// close 停止接收新数据，各处理器写完缓冲区后退出；未结束的聚合窗口由 Close 先行输出
+func (idp *Pool) close() {
+	idp.closeLock.Lock()
+	if idp.closed {
+		idp.closeLock.Unlock()
+		return
+	}
+
+	idp.closed = true
+	idp.closeLock.Unlock()
+
+	close(idp.stop)
+	idp.stopped.Wait()
+}
+
 func (idp *Pool) handleInfluxDbChan(handler *Handler) {
+	defer idp.stopped.Done()
+
 	var writeBuffer []Point
 	for {
-		value := <-handler.channel
+		var value Point
+		select {
+		case value = <-handler.channel:
+		case <-idp.stop:
+			idp.shutdownHandler(handler, writeBuffer)
+			return
+		}
 
 		var buffer []Point
 		idp.handlerLock.Lock()
@@ -105,10 +182,7 @@ func (idp *Pool) handleInfluxDbChan(handler *Handler) {
 		idp.handlerLock.Unlock()
 
 		_ = handler.client.Init()
-		err := handler.client.WriteBatch(&buffer)
-		if err != nil {
-			idp.log.E("influxDbClient.Write: %v", err)
-		}
+		idp.flush(handler, buffer)
 
 		idp.handlerLock.Lock()
 		idp.lastWriteTime = time.Now()
@@ -117,6 +191,20 @@ func (idp *Pool) handleInfluxDbChan(handler *Handler) {
 	}
 }
 
+// shutdownHandler 写入缓冲区及通道中剩余的数据
+func (idp *Pool) shutdownHandler(handler *Handler, writeBuffer []Point) {
+	for len(handler.channel) > 0 {
+		writeBuffer = append(writeBuffer, <-handler.channel)
+	}
+
+	if len(writeBuffer) == 0 {
+		return
+	}
+
+	_ = handler.client.Init()
+	idp.flush(handler, writeBuffer)
+}
+
 func (idp *Pool) canWriteBatch(writeBuffer []Point) bool {
 	return len(writeBuffer) >= config.GetBaseConfig().InfluxMaxBufferSize || time.Now().After(idp.lastWriteTime.Add(time.Duration(config.GetBaseConfig().InfluxMaxIntervalTime)*time.Second))
 }
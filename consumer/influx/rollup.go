@@ -0,0 +1,259 @@
+package influx
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const defaultRollupDelay = 10
+
+// rollupField 一个字段在窗口内的统计，mean/min/max/sum 只统计数值
+type rollupField struct {
+	count   int64
+	numeric int64
+	sum     float64
+	min     float64
+	max     float64
+	last    any
+	lastAt  time.Time
+}
+
+type rollupWindow struct {
+	start       time.Time
+	measurement string
+	tags        map[string]string
+	fields      map[string]*rollupField
+}
+
+// rollup 按 influx_rollups 中的一条规则做滚动窗口聚合，窗口结束 delay 后输出
+type rollup struct {
+	rule    config.InfluxRollupRule
+	window  time.Duration
+	delay   time.Duration
+	lock    sync.Mutex
+	windows map[string]*rollupWindow
+}
+
+func newRollups() []*rollup {
+	var rollups []*rollup
+	for _, rule := range config.GetInfluxRollupRules() {
+		delay := rule.Delay
+		if delay <= 0 {
+			delay = defaultRollupDelay
+		}
+
+		rollups = append(rollups, &rollup{
+			rule:    rule,
+			window:  time.Duration(rule.Window) * time.Second,
+			delay:   time.Duration(delay) * time.Second,
+			windows: make(map[string]*rollupWindow),
+		})
+	}
+
+	return rollups
+}
+
+// add 点计入窗口时返回 true。窗口已输出后到达的迟到点不再聚合，返回 false 并计数，
+// 由调用方按原始数据写入，即使规则配置了 drop_raw 也不会丢失
+func (r *rollup) add(point Point) bool {
+	if matched, _ := path.Match(r.rule.Measurement, point.Measurement); !matched {
+		return false
+	}
+
+	timestamp := point.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	start := timestamp.Truncate(r.window)
+	if !time.Now().Before(start.Add(r.window + r.delay)) {
+		metrics.Add("influx_rollup_late_points", 1)
+		return false
+	}
+
+	tags := make(map[string]string)
+	key := strings.Builder{}
+	key.WriteString(fmt.Sprintf("%d,%s", start.UnixNano(), point.Measurement))
+	for _, name := range r.rule.GroupBy {
+		value, ok := point.Tags[name]
+		if ok {
+			tags[name] = value
+		}
+
+		key.WriteString("," + name + "=" + value)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	window, ok := r.windows[key.String()]
+	if !ok {
+		window = &rollupWindow{start: start, measurement: point.Measurement, tags: tags, fields: make(map[string]*rollupField)}
+		r.windows[key.String()] = window
+	}
+
+	for name, value := range point.Fields {
+		if _, ok := lookupPattern(r.rule.Aggregates, name); !ok {
+			continue
+		}
+
+		field, ok := window.fields[name]
+		if !ok {
+			field = &rollupField{}
+			window.fields[name] = field
+		}
+
+		field.add(value, timestamp)
+	}
+
+	return true
+}
+
+func (f *rollupField) add(value any, timestamp time.Time) {
+	f.count++
+	if f.lastAt.IsZero() || !timestamp.Before(f.lastAt) {
+		f.last = value
+		f.lastAt = timestamp
+	}
+
+	// 字符串和布尔值只参与 count 与 last
+	switch value.(type) {
+	case string, bool:
+		return
+	}
+
+	number, err := toFloat(value)
+	if err != nil {
+		return
+	}
+
+	if f.numeric == 0 || number < f.min {
+		f.min = number
+	}
+
+	if f.numeric == 0 || number > f.max {
+		f.max = number
+	}
+
+	f.sum += number
+	f.numeric++
+}
+
+// due 取出已结束的窗口，all 为 true 时取出所有窗口
+func (r *rollup) due(now time.Time, all bool) []*rollupWindow {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var windows []*rollupWindow
+	for key, window := range r.windows {
+		if !all && now.Before(window.start.Add(r.window+r.delay)) {
+			continue
+		}
+
+		windows = append(windows, window)
+		delete(r.windows, key)
+	}
+
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].start.Before(windows[j].start)
+	})
+
+	return windows
+}
+
+func (r *rollup) target(measurement string) string {
+	target := r.rule.Target
+	if target == "" {
+		target = fmt.Sprintf("{measurement}_%ds", r.rule.Window)
+	}
+
+	return strings.ReplaceAll(target, "{measurement}", measurement)
+}
+
+// point 字段名为 <字段>_<聚合函数>，时间为窗口起点
+func (r *rollup) point(window *rollupWindow) (Point, bool) {
+	fields := make(map[string]any)
+	for name, field := range window.fields {
+		aggregates, _ := lookupPattern(r.rule.Aggregates, name)
+		for _, aggregate := range aggregates {
+			switch aggregate {
+			case "count":
+				fields[name+"_count"] = field.count
+			case "last":
+				fields[name+"_last"] = field.last
+			}
+
+			if field.numeric == 0 {
+				continue
+			}
+
+			switch aggregate {
+			case "mean":
+				fields[name+"_mean"] = field.sum / float64(field.numeric)
+			case "min":
+				fields[name+"_min"] = field.min
+			case "max":
+				fields[name+"_max"] = field.max
+			case "sum":
+				fields[name+"_sum"] = field.sum
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return Point{}, false
+	}
+
+	return Point{
+		Measurement: r.target(window.measurement),
+		Tags:        window.tags,
+		Fields:      fields,
+		Timestamp:   window.start,
+	}, true
+}
+
+// runRollups 每秒输出已结束的窗口，连接池关闭时退出
+func (idp *Pool) runRollups() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			idp.emitRollups(now, false)
+		case <-idp.stop:
+			return
+		}
+	}
+}
+
+// emitRollups 输出已结束的窗口，all 为 true 时输出所有窗口；指定保留策略时写入对应的连接池
+func (idp *Pool) emitRollups(now time.Time, all bool) {
+	for _, r := range idp.rollups {
+		windows := r.due(now, all)
+		if len(windows) == 0 {
+			continue
+		}
+
+		output := idp
+		if r.rule.RetentionPolicy != "" {
+			output = obtainRetentionPool(idp.db, r.rule.RetentionPolicy)
+		}
+
+		for _, window := range windows {
+			point, ok := r.point(window)
+			if !ok {
+				continue
+			}
+
+			output.send(point)
+			metrics.Add("influx_rollup_points", 1)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package influx
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"venu-data/config"
+)
+
+// recordWriter 记录写入的点
+type recordWriter struct {
+	lock   sync.Mutex
+	points []Point
+}
+
+func (w *recordWriter) Init() error {
+	return nil
+}
+
+func (w *recordWriter) WriteBatch(records *[]Point) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.points = append(w.points, *records...)
+	return nil
+}
+
+func (w *recordWriter) written() []Point {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return append([]Point{}, w.points...)
+}
+
+// newTestPool 处理器写入 writer 的连接池，登记到 sharedDbPool 以便 Close 关闭
+func newTestPool(t *testing.T, writer pointWriter) *Pool {
+	t.Helper()
+
+	idp := &Pool{dbHandlers: make([]*Handler, 1), db: "test_" + t.Name(), stop: make(chan struct{}), rollups: newRollups()}
+	idp.lastWriteTime = time.Now()
+	idp.dbHandlers[0] = &Handler{client: writer, channel: make(chan Point, config.GetBaseConfig().InfluxPoolChannelSize)}
+	idp.stopped.Add(1)
+	go idp.handleInfluxDbChan(idp.dbHandlers[0])
+
+	poolLock.Lock()
+	sharedDbPool[idp.db] = idp
+	poolLock.Unlock()
+
+	t.Cleanup(func() {
+		idp.close()
+
+		poolLock.Lock()
+		delete(sharedDbPool, idp.db)
+		poolLock.Unlock()
+	})
+
+	return idp
+}
+
+func loadRollupConfig(t *testing.T) {
+	loadTestConfig(t, "127.0.0.1:8086", map[string]any{
+		"influx_rollups": []map[string]any{{
+			"measurement": "cpu",
+			"window":      3600,
+			"delay":       60,
+			"group_by":    []string{"host"},
+			"aggregates":  map[string][]string{"usage": {"mean", "count"}},
+			"drop_raw":    true,
+		}},
+	})
+}
+
+func TestRollupLatePointsAreWrittenRaw(t *testing.T) {
+	loadRollupConfig(t)
+	writer := &recordWriter{}
+	idp := newTestPool(t, writer)
+
+	late := time.Now().Add(-3 * time.Hour)
+	if idp.rollups[0].add(Point{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]any{"usage": 1.0}, Timestamp: late}) {
+		t.Fatal("迟到的点不应计入已输出的窗口")
+	}
+
+	if err := idp.writeToInfluxDb("cpu", map[string]string{"host": "a"}, map[string]any{"usage": 2.0}, late); err != nil {
+		t.Fatal(err)
+	}
+
+	idp.close()
+	points := writer.written()
+	if len(points) != 1 || points[0].Measurement != "cpu" || points[0].Fields["usage"] != 2.0 {
+		t.Fatalf("迟到的点应按原始数据写入：%v", points)
+	}
+}
+
+func TestCloseFlushesOpenRollupWindows(t *testing.T) {
+	loadRollupConfig(t)
+	writer := &recordWriter{}
+	idp := newTestPool(t, writer)
+
+	now := time.Now()
+	for _, usage := range []float64{1, 2, 3} {
+		if err := idp.writeToInfluxDb("cpu", map[string]string{"host": "a"}, map[string]any{"usage": usage}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if points := writer.written(); len(points) != 0 {
+		t.Fatalf("窗口未结束前不应输出：%v", points)
+	}
+
+	Close()
+
+	points := writer.written()
+	if len(points) != 1 {
+		t.Fatalf("关闭时应输出 1 个聚合点：%v", points)
+	}
+
+	if points[0].Measurement != "cpu_3600s" || points[0].Fields["usage_mean"] != 2.0 || points[0].Fields["usage_count"] != int64(3) {
+		t.Errorf("聚合结果有误：%v", points[0])
+	}
+}
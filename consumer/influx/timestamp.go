@@ -0,0 +1,199 @@
+package influx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"venu-data/config"
+	"venu-data/consumer/base"
+	"venu-data/internal/metrics"
+)
+
+const (
+	fallbackKafka    = "kafka"
+	invalidReject    = "reject"
+	defaultPrecision = "ns"
+)
+
+// Timestamp 消息中的时间戳，可以是字符串或数字，由 timestampDecoder 解析
+type Timestamp struct {
+	Value  string
+	Number bool
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*t = Timestamp{}
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		*t = Timestamp{}
+		return json.Unmarshal(data, &t.Value)
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("时间戳格式有误：%s", data)
+	}
+
+	*t = Timestamp{Value: n.String(), Number: true}
+	return nil
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.Number {
+		return []byte(t.Value), nil
+	}
+
+	return json.Marshal(t.Value)
+}
+
+// timestampDecoder 按主题的 timestamp 配置解析时间戳，见 config.TimestampConfig
+type timestampDecoder struct {
+	layouts []string
+	unit    string
+	loc     *time.Location
+}
+
+func newTimestampDecoder(conf *config.TimestampConfig) *timestampDecoder {
+	decoder := &timestampDecoder{layouts: []string{time.RFC3339Nano}, unit: "auto", loc: time.Local}
+	if conf == nil {
+		return decoder
+	}
+
+	if len(conf.Layouts) > 0 {
+		decoder.layouts = conf.Layouts
+	}
+
+	if conf.EpochUnit != "" {
+		decoder.unit = conf.EpochUnit
+	}
+
+	// 时区已在 config.Init 中校验
+	if loc, err := time.LoadLocation(conf.Timezone); err == nil && conf.Timezone != "" {
+		decoder.loc = loc
+	}
+
+	return decoder
+}
+
+func (d *timestampDecoder) parse(ts Timestamp) (time.Time, error) {
+	if !ts.Number {
+		for _, layout := range d.layouts {
+			if t, err := time.ParseInLocation(layout, ts.Value, d.loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	return d.parseEpoch(ts.Value)
+}
+
+// parseEpoch 解析 Unix 时间，unit 为 auto 时按数值大小推断单位
+func (d *timestampDecoder) parseEpoch(value string) (time.Time, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		unit := d.unit
+		if unit == "auto" {
+			unit = guessEpochUnit(math.Abs(float64(n)))
+		}
+
+		switch unit {
+		case "s":
+			return time.Unix(n, 0), nil
+		case "ms":
+			return time.UnixMilli(n), nil
+		case "us":
+			return time.UnixMicro(n), nil
+		default:
+			return time.Unix(0, n), nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, fmt.Errorf("时间戳无法解析：%s", value)
+	}
+
+	unit := d.unit
+	if unit == "auto" {
+		unit = guessEpochUnit(math.Abs(f))
+	}
+
+	var nanos float64
+	switch unit {
+	case "s":
+		nanos = f * 1e9
+	case "ms":
+		nanos = f * 1e6
+	case "us":
+		nanos = f * 1e3
+	default:
+		nanos = f
+	}
+
+	return time.Unix(0, int64(nanos)), nil
+}
+
+// guessEpochUnit 以 1973 年前后为界，各单位的数值位数不会重叠
+func guessEpochUnit(v float64) string {
+	switch {
+	case v >= 1e17:
+		return "ns"
+	case v >= 1e14:
+		return "us"
+	case v >= 1e11:
+		return "ms"
+	default:
+		return "s"
+	}
+}
+
+// resolve 解析时间戳，为空时使用 fallbackTimestamp，无法解析时按 invalid_timestamp 配置处理
+func (d *timestampDecoder) resolve(ts Timestamp, msg *base.DataMessage) (time.Time, error) {
+	if ts.Value == "" {
+		return fallbackTimestamp(msg), nil
+	}
+
+	t, err := d.parse(ts)
+	if err == nil {
+		return t, nil
+	}
+
+	metrics.Add("influx_invalid_timestamps", 1)
+	if config.GetInfluxConfig().InvalidTimestamp == invalidReject {
+		return time.Time{}, err
+	}
+
+	return fallbackTimestamp(msg), nil
+}
+
+// writePrecision 写入精度，见 config.InfluxConfig
+func writePrecision() string {
+	precision := config.GetInfluxConfig().Precision
+	if precision == "" {
+		return defaultPrecision
+	}
+
+	return precision
+}
+
+// pointPrecision 行协议库中微秒写作 u，见 models.GetPrecisionMultiplier
+func pointPrecision(precision string) string {
+	if precision == "us" {
+		return "u"
+	}
+
+	return precision
+}
+
+// fallbackTimestamp 消息未提供时间戳时使用写入时间或 Kafka 消息时间
+func fallbackTimestamp(msg *base.DataMessage) time.Time {
+	if config.GetInfluxConfig().TimestampFallback == fallbackKafka && msg != nil && !msg.Time.IsZero() {
+		return msg.Time
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,417 @@
+package influx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"venu-data/config"
+	"venu-data/consumer/base"
+)
+
+// 2023-11-14T22:13:20Z
+const testEpoch = 1700000000
+
+func TestTimestampUnmarshal(t *testing.T) {
+	tests := []struct {
+		data string
+		want Timestamp
+	}{
+		{data: `1700000000`, want: Timestamp{Value: "1700000000", Number: true}},
+		{data: `1700000000123456789`, want: Timestamp{Value: "1700000000123456789", Number: true}},
+		{data: `1700000000.5`, want: Timestamp{Value: "1700000000.5", Number: true}},
+		{data: `"1700000000"`, want: Timestamp{Value: "1700000000"}},
+		{data: `"2023-11-14T22:13:20Z"`, want: Timestamp{Value: "2023-11-14T22:13:20Z"}},
+		{data: `null`, want: Timestamp{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			var got Timestamp
+			if err := json.Unmarshal([]byte(test.data), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Fatalf("解析结果 %+v，期望 %+v", got, test.want)
+			}
+		})
+	}
+
+	var ts Timestamp
+	if err := json.Unmarshal([]byte(`true`), &ts); err == nil {
+		t.Fatal("布尔值应解析失败")
+	}
+}
+
+func TestGuessEpochUnit(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 0, want: "s"},
+		{value: testEpoch, want: "s"},
+		{value: 99999999999, want: "s"},
+		{value: 1e11, want: "ms"},
+		{value: testEpoch * 1e3, want: "ms"},
+		{value: 99999999999999, want: "ms"},
+		{value: 1e14, want: "us"},
+		{value: testEpoch * 1e6, want: "us"},
+		{value: 9.9999e16, want: "us"},
+		{value: 1e17, want: "ns"},
+		{value: testEpoch * 1e9, want: "ns"},
+	}
+
+	for _, test := range tests {
+		if got := guessEpochUnit(test.value); got != test.want {
+			t.Errorf("guessEpochUnit(%v) = %s，期望 %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseEpoch(t *testing.T) {
+	base := time.Unix(testEpoch, 0)
+	tests := []struct {
+		name  string
+		unit  string
+		value string
+		want  time.Time
+	}{
+		{name: "自动识别秒", unit: "auto", value: "1700000000", want: base},
+		{name: "自动识别毫秒", unit: "auto", value: "1700000000123", want: base.Add(123 * time.Millisecond)},
+		{name: "自动识别微秒", unit: "auto", value: "1700000000123456", want: base.Add(123456 * time.Microsecond)},
+		{name: "自动识别纳秒", unit: "auto", value: "1700000000123456789", want: base.Add(123456789)},
+		{name: "自动识别负数", unit: "auto", value: "-1700000000000", want: time.Unix(-testEpoch, 0)},
+		{name: "指定秒", unit: "s", value: "1700000000", want: base},
+		{name: "指定毫秒", unit: "ms", value: "1700000000", want: time.UnixMilli(testEpoch)},
+		{name: "指定微秒", unit: "us", value: "1700000000", want: time.UnixMicro(testEpoch)},
+		{name: "指定纳秒", unit: "ns", value: "1700000000", want: time.Unix(0, testEpoch)},
+		{name: "小数秒", unit: "auto", value: "1700000000.25", want: base.Add(250 * time.Millisecond)},
+		{name: "小数毫秒", unit: "auto", value: "1700000000123.5", want: base.Add(123*time.Millisecond + 500*time.Microsecond)},
+		{name: "指定单位的小数", unit: "ms", value: "1700000000.5", want: time.UnixMilli(testEpoch).Add(500 * time.Microsecond)},
+		{name: "科学计数法", unit: "auto", value: "1.7e9", want: base},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &timestampDecoder{unit: test.unit}
+			got, err := d.parseEpoch(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 小数经 float64 换算，允许 1 微秒误差
+			if diff := got.Sub(test.want); diff > time.Microsecond || diff < -time.Microsecond {
+				t.Fatalf("解析结果 %s，期望 %s", got.UTC().Format(time.RFC3339Nano), test.want.UTC().Format(time.RFC3339Nano))
+			}
+		})
+	}
+
+	for _, value := range []string{"", "abc", "NaN", "Inf", "-Inf", "2023-11-14"} {
+		d := &timestampDecoder{unit: "auto"}
+		if _, err := d.parseEpoch(value); err == nil {
+			t.Errorf("%q 应解析失败", value)
+		}
+	}
+}
+
+func TestTimestampDecoderParse(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	utc := time.Unix(testEpoch, 0)
+	tests := []struct {
+		name    string
+		conf    *config.TimestampConfig
+		ts      Timestamp
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "默认 RFC3339", ts: Timestamp{Value: "2023-11-14T22:13:20Z"}, want: utc},
+		{name: "RFC3339 纳秒", ts: Timestamp{Value: "2023-11-14T22:13:20.123456789Z"}, want: utc.Add(123456789)},
+		{name: "RFC3339 带时区偏移", ts: Timestamp{Value: "2023-11-15T06:13:20+08:00"}, want: utc},
+		{name: "数字", ts: Timestamp{Value: "1700000000000", Number: true}, want: utc},
+		{name: "纯数字字符串", ts: Timestamp{Value: "1700000000"}, want: utc},
+		{name: "默认格式不匹配", ts: Timestamp{Value: "2023-11-14 22:13:20"}, wantErr: true},
+		{
+			name: "自定义格式按时区解释",
+			conf: &config.TimestampConfig{Layouts: []string{"2006-01-02 15:04:05"}, Timezone: "Asia/Shanghai"},
+			ts:   Timestamp{Value: "2023-11-15 06:13:20"},
+			want: utc,
+		},
+		{
+			name: "自定义格式按 UTC 解释",
+			conf: &config.TimestampConfig{Layouts: []string{"2006-01-02 15:04:05"}, Timezone: "UTC"},
+			ts:   Timestamp{Value: "2023-11-14 22:13:20"},
+			want: utc,
+		},
+		{
+			name: "依次尝试多个格式",
+			conf: &config.TimestampConfig{Layouts: []string{"2006-01-02 15:04:05", "02/01/2006 15:04"}, Timezone: "Asia/Shanghai"},
+			ts:   Timestamp{Value: "15/11/2023 06:13"},
+			want: utc.Add(-20 * time.Second),
+		},
+		{
+			name: "格式自带时区时忽略配置的时区",
+			conf: &config.TimestampConfig{Layouts: []string{time.RFC3339}, Timezone: "Asia/Shanghai"},
+			ts:   Timestamp{Value: "2023-11-14T22:13:20Z"},
+			want: utc,
+		},
+		{
+			name: "数字不按格式解析",
+			conf: &config.TimestampConfig{Layouts: []string{"20060102"}, EpochUnit: "s"},
+			ts:   Timestamp{Value: "20231114", Number: true},
+			want: time.Unix(20231114, 0),
+		},
+		{
+			name: "纯数字字符串优先按格式解析",
+			conf: &config.TimestampConfig{Layouts: []string{"20060102"}, Timezone: "UTC"},
+			ts:   Timestamp{Value: "20231114"},
+			want: time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "指定单位",
+			conf: &config.TimestampConfig{EpochUnit: "ms"},
+			ts:   Timestamp{Value: "1700000000", Number: true},
+			want: time.UnixMilli(testEpoch),
+		},
+		{
+			name:    "自定义格式不匹配",
+			conf:    &config.TimestampConfig{Layouts: []string{"2006-01-02 15:04:05"}},
+			ts:      Timestamp{Value: "2023-11-14T22:13:20Z"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := newTimestampDecoder(test.conf).parse(test.ts)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("应解析失败，实际 %s", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.Equal(test.want) {
+				t.Fatalf("解析结果 %s，期望 %s", got.UTC().Format(time.RFC3339Nano), test.want.UTC().Format(time.RFC3339Nano))
+			}
+		})
+	}
+
+	decoder := newTimestampDecoder(&config.TimestampConfig{Timezone: "Asia/Shanghai"})
+	if decoder.loc.String() != shanghai.String() {
+		t.Fatalf("时区为 %s，期望 %s", decoder.loc, shanghai)
+	}
+
+	if decoder = newTimestampDecoder(nil); decoder.loc != time.Local || decoder.unit != "auto" {
+		t.Fatalf("默认配置有误：%+v", decoder)
+	}
+}
+
+func TestTimestampResolve(t *testing.T) {
+	kafkaTime := time.Unix(testEpoch-3600, 0)
+	msg := &base.DataMessage{}
+	msg.Time = kafkaTime
+
+	tests := []struct {
+		name    string
+		influx  map[string]any
+		ts      Timestamp
+		want    time.Time
+		now     bool
+		wantErr bool
+	}{
+		{name: "可解析", ts: Timestamp{Value: "1700000000", Number: true}, want: time.Unix(testEpoch, 0)},
+		{name: "为空时使用写入时间", ts: Timestamp{}, now: true},
+		{name: "无法解析时使用写入时间", ts: Timestamp{Value: "yesterday"}, now: true},
+		{name: "无法解析时使用 Kafka 时间", influx: map[string]any{"timestamp_fallback": "kafka"}, ts: Timestamp{Value: "yesterday"}, want: kafkaTime},
+		{name: "无法解析时丢弃", influx: map[string]any{"invalid_timestamp": "reject"}, ts: Timestamp{Value: "yesterday"}, wantErr: true},
+		{name: "丢弃不影响空时间戳", influx: map[string]any{"invalid_timestamp": "reject"}, ts: Timestamp{}, now: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overrides := map[string]any{}
+			if test.influx != nil {
+				overrides["influx"] = test.influx
+			}
+
+			loadTestConfig(t, "127.0.0.1:8086", overrides)
+
+			before := time.Now()
+			got, err := newTimestampDecoder(nil).resolve(test.ts, msg)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("应返回错误，实际 %s", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.now {
+				if got.Before(before) || got.After(time.Now()) {
+					t.Fatalf("应使用写入时间，实际 %s", got)
+				}
+
+				return
+			}
+
+			if !got.Equal(test.want) {
+				t.Fatalf("解析结果 %s，期望 %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFallbackTimestamp(t *testing.T) {
+	kafkaTime := time.Unix(testEpoch, 0)
+	withTime := &base.DataMessage{}
+	withTime.Time = kafkaTime
+
+	tests := []struct {
+		name     string
+		fallback string
+		msg      *base.DataMessage
+		kafka    bool
+	}{
+		{name: "默认使用写入时间", msg: withTime},
+		{name: "ingest", fallback: "ingest", msg: withTime},
+		{name: "kafka", fallback: "kafka", msg: withTime, kafka: true},
+		{name: "kafka 消息没有时间", fallback: "kafka", msg: &base.DataMessage{}},
+		{name: "kafka 没有消息", fallback: "kafka"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestConfig(t, "127.0.0.1:8086", map[string]any{"influx": map[string]any{"timestamp_fallback": test.fallback}})
+
+			before := time.Now()
+			got := fallbackTimestamp(test.msg)
+			if test.kafka {
+				if !got.Equal(kafkaTime) {
+					t.Fatalf("应使用 Kafka 消息时间，实际 %s", got)
+				}
+
+				return
+			}
+
+			if got.Before(before) || got.After(time.Now()) {
+				t.Fatalf("应使用写入时间，实际 %s", got)
+			}
+		})
+	}
+}
+
+// 每个点按自身时间戳和配置的精度写入，1.x 与 2.x 一致
+func TestWriteBatchPrecision(t *testing.T) {
+	points := []Point{
+		{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]any{"usage": 1.5}, Timestamp: time.Unix(testEpoch, 123456789)},
+		{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]any{"usage": 2.5}, Timestamp: time.Unix(testEpoch+1, 987654321)},
+	}
+
+	// 1.x 的微秒精度按纳秒写入截断后的时间
+	tests := []struct {
+		precision string
+		query     string
+		times     []string
+		v1Query   string
+		v1Times   []string
+	}{
+		{precision: "", query: "ns", times: []string{"1700000000123456789", "1700000001987654321"}},
+		{precision: "ns", query: "ns", times: []string{"1700000000123456789", "1700000001987654321"}},
+		{
+			precision: "us", query: "us", times: []string{"1700000000123456", "1700000001987654"},
+			v1Query: "ns", v1Times: []string{"1700000000123456000", "1700000001987654000"},
+		},
+		{precision: "ms", query: "ms", times: []string{"1700000000123", "1700000001987"}},
+		{precision: "s", query: "s", times: []string{"1700000000", "1700000001"}},
+	}
+
+	clients := []struct {
+		name   string
+		path   string
+		client func(t *testing.T, server *httptest.Server, influx map[string]any) pointWriter
+	}{
+		{
+			name: "1.x",
+			path: "/write",
+			client: func(t *testing.T, server *httptest.Server, influx map[string]any) pointWriter {
+				influx["skip_create_database"] = true
+				return newTestV1Client(t, server, influx)
+			},
+		},
+		{
+			name: "2.x",
+			path: "/api/v2/write",
+			client: func(t *testing.T, server *httptest.Server, influx map[string]any) pointWriter {
+				return newTestV2Client(t, server, influx, "")
+			},
+		},
+	}
+
+	for _, c := range clients {
+		for _, test := range tests {
+			t.Run(c.name+"/"+test.query, func(t *testing.T) {
+				server, requests := newWriteServer(t, c.path)
+				writer := c.client(t, server, map[string]any{"precision": test.precision})
+
+				batch := append([]Point(nil), points...)
+				if err := writer.WriteBatch(&batch); err != nil {
+					t.Fatal(err)
+				}
+
+				query, times := test.query, test.times
+				if c.name == "1.x" && test.v1Times != nil {
+					query, times = test.v1Query, test.v1Times
+				}
+
+				r := <-requests
+				if r.query["precision"] != query {
+					t.Errorf("precision 参数：%q，期望 %q", r.query["precision"], query)
+				}
+
+				want := fmt.Sprintf("cpu,host=a usage=1.5 %s\ncpu,host=a usage=2.5 %s", times[0], times[1])
+				if got := strings.TrimSpace(r.body); got != want {
+					t.Errorf("请求内容：\n%s\n期望：\n%s", got, want)
+				}
+			})
+		}
+	}
+}
+
+// 没有时间戳的点使用写入时间
+func TestWriteBatchZeroTimestamp(t *testing.T) {
+	server, requests := newWriteServer(t, "/api/v2/write")
+	writer := newTestV2Client(t, server, map[string]any{"precision": "s"}, "")
+
+	before := time.Now().Unix()
+	batch := []Point{{Measurement: "cpu", Fields: map[string]any{"usage": 1.5}}}
+	if err := writer.WriteBatch(&batch); err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.TrimSpace((<-requests).body)
+	got, err := strconv.ParseInt(body[strings.LastIndex(body, " ")+1:], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got < before || got > time.Now().Unix() {
+		t.Fatalf("应使用写入时间，实际 %d", got)
+	}
+}
@@ -0,0 +1,56 @@
+package influx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"venu-data/config"
+)
+
+var tlsOnce sync.Once
+var tlsConfig *tls.Config
+var tlsErr error
+
+// baseUrl 按 influx.https 选择协议
+func baseUrl(host string, port string) string {
+	scheme := "http"
+	if config.GetInfluxConfig().Https {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+}
+
+// loadTlsConfig 配置了 CA 时加载证书，只加载一次；未使用 HTTPS 时返回 nil
+func loadTlsConfig() (*tls.Config, error) {
+	conf := config.GetInfluxConfig()
+	if !conf.Https {
+		return nil, nil
+	}
+
+	tlsOnce.Do(func() {
+		tlsConfig = &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+		if conf.CaFile == "" {
+			return
+		}
+
+		pem, err := os.ReadFile(conf.CaFile)
+		if err != nil {
+			tlsErr = fmt.Errorf("读取 influx CA 文件失败：%v", err)
+			return
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			tlsErr = fmt.Errorf("CA 文件中没有有效证书：%s", conf.CaFile)
+			return
+		}
+
+		tlsConfig.RootCAs = pool
+	})
+
+	return tlsConfig, tlsErr
+}
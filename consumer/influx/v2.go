@@ -0,0 +1,168 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"venu-data/config"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// pointWriter Client 与 V2Client 的公共部分，由配置中的 influx.version 选择
+type pointWriter interface {
+	Init() error
+	WriteBatch(records *[]Point) error
+}
+
+// retentionPolicy 为空时使用 influx.retention_policy
+func newPointWriter(database string, retentionPolicy string, host string, port string, debug bool) pointWriter {
+	if config.GetInfluxConfig().Version == 2 {
+		return NewV2Client(database, retentionPolicy, host, port, debug)
+	}
+
+	c := NewClient(database, host, port, debug)
+	c.retentionPolicy = retentionPolicy
+	return c
+}
+
+// V2Client 通过 /api/v2/write 写入行协议，适用于 InfluxDB 2.x/3.x。
+// 库名按 influx.buckets 映射为 bucket，指定保留策略时写入 <bucket>/<rp>，bucket 需预先创建。
+type V2Client struct {
+	httpClient *http.Client
+	writeUrl   string
+	token      string
+	gzip       bool
+
+	database string
+	debug    bool
+	log      *log.Log
+}
+
+func NewV2Client(database string, retentionPolicy string, host string, port string, debug bool) *V2Client {
+	conf := config.GetInfluxConfig()
+
+	bucket := config.InfluxBucket(database)
+	if retentionPolicy != "" {
+		bucket += "/" + retentionPolicy
+	}
+
+	query := url.Values{}
+	query.Set("org", conf.Org)
+	query.Set("bucket", bucket)
+	query.Set("precision", writePrecision())
+
+	// TLS 配置有误时在写入时报错
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig, _ = loadTlsConfig()
+
+	c := &V2Client{
+		httpClient: &http.Client{Timeout: 1 * time.Minute, Transport: transport},
+		writeUrl:   fmt.Sprintf("%s/api/v2/write?%s", baseUrl(host, port), query.Encode()),
+		token:      conf.Token,
+		gzip:       conf.Gzip,
+		database:   database,
+		debug:      debug,
+		log:        log.NewLog("IV2"),
+	}
+	c.log.SetFlag(log.FlagColorEnabled)
+	return c
+}
+
+// Init HTTP 客户端无需建立连接，只检查 TLS 配置
+func (vc *V2Client) Init() error {
+	_, err := loadTlsConfig()
+	return err
+}
+
+// v2Error /api/v2/write 失败时返回的 JSON
+type v2Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (vc *V2Client) WriteBatch(records *[]Point) error {
+	precision := pointPrecision(writePrecision())
+
+	var body bytes.Buffer
+	for _, r := range *records {
+		if r.raw != nil {
+			body.WriteString(r.raw.PrecisionString(precision))
+			body.WriteByte('\n')
+			continue
+		}
+
+		timestamp := r.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+
+		p, err := client.NewPoint(r.Measurement, r.Tags, r.Fields, timestamp)
+		if err != nil {
+			return err
+		}
+
+		body.WriteString(p.PrecisionString(precision))
+		body.WriteByte('\n')
+	}
+
+	payload := body.Bytes()
+	if vc.gzip {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(payload); err != nil {
+			return err
+		}
+
+		if err := writer.Close(); err != nil {
+			return err
+		}
+
+		payload = compressed.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, vc.writeUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if vc.token != "" {
+		req.Header.Set("Authorization", "Token "+vc.token)
+	}
+
+	if vc.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := vc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var e v2Error
+		if json.Unmarshal(content, &e) == nil && e.Message != "" {
+			return fmt.Errorf("influx 写入失败（%d %s）：%s", resp.StatusCode, e.Code, e.Message)
+		}
+
+		return fmt.Errorf("influx 写入失败（%d）：%s", resp.StatusCode, bytes.TrimSpace(content))
+	}
+
+	if vc.debug {
+		vc.log.D("写入数据 %d 条", len(*records))
+	}
+
+	return nil
+}
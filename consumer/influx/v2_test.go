@@ -0,0 +1,180 @@
+package influx
+
+import (
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeRequest 测试服务收到的写入请求
+type writeRequest struct {
+	header http.Header
+	query  map[string]string
+	body   string
+}
+
+// newV2Server 记录请求并按 status 和 response 应答
+func newV2Server(t *testing.T, status int, response string) (*httptest.Server, chan writeRequest) {
+	t.Helper()
+
+	requests := make(chan writeRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" {
+			t.Errorf("请求路径有误：%s", r.URL.Path)
+		}
+
+		request, ok := readRequest(t, r)
+		if !ok {
+			return
+		}
+
+		requests <- request
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// readRequest 读取请求头、查询参数和请求体，请求体按 Content-Encoding 解压
+func readRequest(t *testing.T, r *http.Request) (writeRequest, bool) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("gzip 解压失败：%v", err)
+			return writeRequest{}, false
+		}
+
+		reader = gz
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Errorf("读取请求失败：%v", err)
+		return writeRequest{}, false
+	}
+
+	query := make(map[string]string)
+	for key := range r.URL.Query() {
+		query[key] = r.URL.Query().Get(key)
+	}
+
+	return writeRequest{header: r.Header.Clone(), query: query, body: string(body)}, true
+}
+
+func newTestV2Client(t *testing.T, server *httptest.Server, influx map[string]any, retentionPolicy string) *V2Client {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := map[string]any{"version": 2, "org": "venus", "token": "secret"}
+	for key, value := range influx {
+		conf[key] = value
+	}
+
+	loadTestConfig(t, host+":"+port, map[string]any{"influx": conf})
+	return NewV2Client("metrics", retentionPolicy, host, port, false)
+}
+
+func testPoints() []Point {
+	return []Point{
+		{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]any{"usage": 1.5}, Timestamp: time.Unix(1700000000, 0)},
+		{Measurement: "cpu", Tags: map[string]string{"host": "b"}, Fields: map[string]any{"usage": int64(2)}, Timestamp: time.Unix(1700000001, 0)},
+	}
+}
+
+func TestV2WriteRequest(t *testing.T) {
+	tests := []struct {
+		name            string
+		influx          map[string]any
+		retentionPolicy string
+		bucket          string
+		precision       string
+		body            string
+	}{
+		{
+			name:      "默认",
+			bucket:    "metrics",
+			precision: "ns",
+			body:      "cpu,host=a usage=1.5 1700000000000000000\ncpu,host=b usage=2i 1700000001000000000\n",
+		},
+		{
+			name:            "gzip、bucket 映射和精度",
+			influx:          map[string]any{"gzip": true, "precision": "s", "buckets": map[string]string{"metrics": "prod"}},
+			retentionPolicy: "rp_1h",
+			bucket:          "prod/rp_1h",
+			precision:       "s",
+			body:            "cpu,host=a usage=1.5 1700000000\ncpu,host=b usage=2i 1700000001\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newV2Server(t, http.StatusNoContent, "")
+			c := newTestV2Client(t, server, tt.influx, tt.retentionPolicy)
+
+			points := testPoints()
+			if err := c.WriteBatch(&points); err != nil {
+				t.Fatal(err)
+			}
+
+			r := <-requests
+			if got := r.header.Get("Authorization"); got != "Token secret" {
+				t.Errorf("Authorization：%q", got)
+			}
+
+			gzipped := r.header.Get("Content-Encoding") == "gzip"
+			if want := tt.influx["gzip"] == true; gzipped != want {
+				t.Errorf("gzip：%v，期望 %v", gzipped, want)
+			}
+
+			want := map[string]string{"org": "venus", "bucket": tt.bucket, "precision": tt.precision}
+			for key, value := range want {
+				if r.query[key] != value {
+					t.Errorf("查询参数 %s：%q，期望 %q", key, r.query[key], value)
+				}
+			}
+
+			if r.body != tt.body {
+				t.Errorf("请求内容：\n%s期望：\n%s", r.body, tt.body)
+			}
+		})
+	}
+}
+
+func TestV2WriteError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     string
+	}{
+		{"JSON 错误", http.StatusBadRequest, `{"code":"invalid","message":"unable to parse 'cpu usage=': missing field value"}`, "influx 写入失败（400 invalid）：unable to parse 'cpu usage=': missing field value"},
+		{"无权限", http.StatusUnauthorized, `{"code":"unauthorized","message":"unauthorized access"}`, "influx 写入失败（401 unauthorized）：unauthorized access"},
+		{"非 JSON", http.StatusBadGateway, "bad gateway\n", "influx 写入失败（502）：bad gateway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newV2Server(t, tt.status, tt.response)
+			c := newTestV2Client(t, server, nil, "")
+
+			points := testPoints()
+			err := c.WriteBatch(&points)
+			<-requests
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("错误：%v，期望：%s", err, tt.want)
+			}
+		})
+	}
+}
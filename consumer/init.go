@@ -6,11 +6,13 @@ import (
 	prettyLog "github.com/my-dev-lib/pretty-log-go"
 	"github.com/segmentio/kafka-go"
 	log2 "log"
+	"sync"
 	"venu-data/config"
 	"venu-data/consumer/base"
 	"venu-data/consumer/influx"
 	"venu-data/consumer/mysql"
 	"venu-data/internal/argparser"
+	"venu-data/internal/metrics"
 )
 
 const (
@@ -27,13 +29,18 @@ type DataConsumer interface {
 type VenusConsumer struct {
 	debug     bool
 	log       *prettyLog.Log
-	reader    *kafka.Reader
 	consumers map[string]DataConsumer
+
+	// ctx 取消后各 Handle 处理完当前消息即退出，handlers 等待其全部退出
+	ctx      context.Context
+	cancel   context.CancelFunc
+	handlers sync.WaitGroup
 }
 
 func (vc *VenusConsumer) Init() {
 	vc.log = prettyLog.NewLog("VD")
 	vc.consumers = make(map[string]DataConsumer)
+	vc.ctx, vc.cancel = context.WithCancel(context.Background())
 
 	topicsConf := config.GetTopicsConfig()
 
@@ -60,15 +67,26 @@ func (vc *VenusConsumer) UnRegisterDataConsumer(consumer DataConsumer) {
 }
 
 func (vc *VenusConsumer) Handle(consume DataConsumer) {
+	defer vc.handlers.Done()
+
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers: config.Get().KafkaBrokers,
 		Topic:   consume.Topic(),
 		GroupID: consume.GroupId(),
 	})
+	defer func() {
+		_ = reader.Close()
+	}()
+
 	for {
-		msg, err := reader.ReadMessage(context.Background())
+		// 设置了 GroupID 时 ReadMessage 返回前已提交位移，读到的消息必须在连接池关闭前交给 Consume
+		msg, err := reader.ReadMessage(vc.ctx)
 
 		if err != nil {
+			if vc.ctx.Err() != nil {
+				return
+			}
+
 			vc.log.E("r.ReadMessage %v", err)
 			continue
 		}
@@ -82,12 +100,15 @@ func (vc *VenusConsumer) Handle(consume DataConsumer) {
 
 func (vc *VenusConsumer) Start() {
 	for _, consumer := range vc.consumers {
+		vc.handlers.Add(1)
 		go vc.Handle(consumer)
 	}
 }
 
+// Close 停止读取新消息，等待正在处理的消息交给连接池后返回
 func (vc *VenusConsumer) Close() {
-	_ = vc.reader.Close()
+	vc.cancel()
+	vc.handlers.Wait()
 }
 
 func (*VenusConsumer) getConsumers2(topicsConf []config.TopicConfig) []DataConsumer {
@@ -104,10 +125,18 @@ func (*VenusConsumer) getConsumers2(topicsConf []config.TopicConfig) []DataConsu
 					dataConsumers = append(dataConsumers, mysql.NewMysqlReaderConsumer(conf))
 				}
 			}
+		} else if conf.StorageType == "mysql_cdc" {
+			for i := 0; i < conf.ConsumeNum; i++ {
+				dataConsumers = append(dataConsumers, mysql.NewMysqlCdcReaderConsumer(conf))
+			}
 		} else if conf.StorageType == "influxdb" {
 			for i := 0; i < conf.ConsumeNum; i++ {
 				dataConsumers = append(dataConsumers, influx.NewInfluxReaderConsumer(conf))
 			}
+		} else if conf.StorageType == "influx_lineprotocol" {
+			for i := 0; i < conf.ConsumeNum; i++ {
+				dataConsumers = append(dataConsumers, influx.NewLineProtocolConsumer(conf))
+			}
 		}
 	}
 	return dataConsumers
@@ -129,7 +158,7 @@ func handleArgs() StartArg {
 
 	argParser := argparser.NewArgParser([][]any{
 		{kafkaArgName, argparser.TypeString, "Kafka 地址，格式为 192.168.1.1:9092;192.168.1.2:9092", ""},
-		{mysqlArgName, argparser.TypeString, "mysql 地址，格式为 192.168.1.1:3306@root/123456", ""},
+		{mysqlArgName, argparser.TypeString, "mysql 地址，格式为 192.168.1.1:3306@root/123456，逗号分隔多个地址用于故障切换，账号也可在配置文件 mysql 块中提供", ""},
 		{influxArgName, argparser.TypeString, "influx 地址，格式为 192.168.1.1:8086", ""},
 	})
 
@@ -164,7 +193,28 @@ func Start() {
 
 	log.I("\n" + prettyLog.GetHighlightLine(fmt.Sprintf("消费程序已启动 v%s", version), 30))
 
-	var vc VenusConsumer
-	vc.Init()
-	vc.Start()
+	if addr := config.GetBaseConfig().MetricsAddr; addr != "" {
+		go func() {
+			err := metrics.Serve(addr)
+			if err != nil {
+				log.E("指标服务启动失败：%v", err)
+			}
+		}()
+	}
+
+	mysql.StartRetention()
+	mysql.StartPartitionManager()
+
+	venus.Init()
+	venus.Start()
+}
+
+var venus VenusConsumer
+
+// Stop 先停止读取 Kafka，再写入缓冲的数据，influx 未结束的聚合窗口也会输出
+func Stop() {
+	log.I("消费程序正在退出，写入缓冲数据")
+	venus.Close()
+	influx.Close()
+	mysql.Close()
 }
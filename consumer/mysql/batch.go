@@ -0,0 +1,219 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"strings"
+	"venu-data/config"
+)
+
+// sqlExecutor *sql.DB 与 *sql.Tx 的公共部分
+type sqlExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// RejectedRequest 因数据本身错误而无法写入的请求
+type RejectedRequest struct {
+	Request InsertRequest
+	Err     error
+}
+
+// 以下错误只与出错的行有关，拆批后可定位到具体的行；
+// 其余错误（权限、语法、连接等）整批回滚后重试，未知列的处理见 writeIsolated
+var rowErrorNumbers = map[uint16]bool{
+	1048: true, // ER_BAD_NULL_ERROR
+	1062: true, // ER_DUP_ENTRY
+	1264: true, // ER_WARN_DATA_OUT_OF_RANGE
+	1265: true, // WARN_DATA_TRUNCATED
+	1292: true, // ER_TRUNCATED_WRONG_VALUE
+	1300: true, // ER_INVALID_CHARACTER_STRING
+	1366: true, // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+	1367: true, // ER_ILLEGAL_VALUE_FOR_TYPE
+	1406: true, // ER_DATA_TOO_LONG
+	1451: true, // ER_ROW_IS_REFERENCED_2
+	1452: true, // ER_NO_REFERENCED_ROW_2
+	1690: true, // ER_DATA_OUT_OF_RANGE
+	3140: true, // ER_INVALID_JSON_TEXT
+	3819: true, // ER_CHECK_CONSTRAINT_VIOLATED
+}
+
+// errConvertArgument database/sql 无法转换参数时的错误前缀，如字段值为嵌套对象或数组，没有对应的错误类型
+const errConvertArgument = "sql: converting argument"
+
+// isDataError 判断是否为行数据错误，其余错误返回 false
+func isDataError(err error) bool {
+	var identifierErr *IdentifierError
+	var rowTooLargeErr *rowTooLargeError
+	if errors.As(err, &identifierErr) || errors.As(err, &rowTooLargeErr) || errors.Is(err, mysqlDriver.ErrPktTooLarge) {
+		return true
+	}
+
+	if strings.Contains(err.Error(), errConvertArgument) {
+		return true
+	}
+
+	var mysqlErr *mysqlDriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+
+	return rowErrorNumbers[mysqlErr.Number]
+}
+
+// RequestBatch 在一个事务中写入整批请求。
+// 遇到数据错误时二分拆批，定位出错的行并返回，其余行正常提交；
+// 遇到其他错误时整批回滚并返回 error，由调用方保留缓冲区重试。
+func (dc *Client) RequestBatch(requests *[]InsertRequest) ([]RejectedRequest, error) {
+	if config.GetBaseConfig().MysqlAddColumns {
+		err := dc.ensureRequestColumns(*requests)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := dc.dbClient.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败：%v", err)
+	}
+
+	var rejected []RejectedRequest
+
+	// 写入与删除需保持先后顺序，按连续的同类请求分段处理
+	start := 0
+	for i := 1; i <= len(*requests); i++ {
+		if i < len(*requests) && (*requests)[i].Delete == (*requests)[start].Delete {
+			continue
+		}
+
+		segmentRejected, err := dc.requestSegment(tx, (*requests)[start:i])
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+
+		rejected = append(rejected, segmentRejected...)
+
+		start = i
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("提交事务失败：%v", err)
+	}
+
+	return rejected, nil
+}
+
+func (dc *Client) requestSegment(tx *sql.Tx, requests []InsertRequest) ([]RejectedRequest, error) {
+	type tableGroup struct {
+		table     string
+		signature string
+		requests  []InsertRequest
+	}
+
+	// 写入按表和列集合分组，使每条语句内各行的列一致。
+	// 同一张表只向最近的分组追加，列集合变化时新开分组，保证同表内的写入顺序
+	var groups []*tableGroup
+	last := make(map[string]*tableGroup)
+	for _, req := range requests {
+		signature := ""
+		if !req.Delete {
+			_, signature = columnSignature(req.Data)
+		}
+
+		group, exists := last[req.Table]
+		if !exists || group.signature != signature {
+			group = &tableGroup{table: req.Table, signature: signature}
+			last[req.Table] = group
+			groups = append(groups, group)
+		}
+
+		group.requests = append(group.requests, req)
+	}
+
+	var rejected []RejectedRequest
+	for _, group := range groups {
+		table := group.table
+		if dc.debug {
+			if group.requests[0].Delete {
+				dc.dbLog.D("删除 %s 表，%d 条数据", table, len(group.requests))
+			} else {
+				dc.dbLog.D("插入 %s 表，%d 条数据", table, len(group.requests))
+			}
+		}
+
+		groupRejected, err := dc.writeIsolated(tx, table, group.requests)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to write to %s: %w", table, err)
+		}
+
+		rejected = append(rejected, groupRejected...)
+	}
+
+	return rejected, nil
+}
+
+// writeIsolated 写入同一张表的请求，数据错误时递归二分直到找出出错的行。
+// MySQL 中失败的语句只回滚自身，事务内已成功的部分不受影响。
+func (dc *Client) writeIsolated(tx *sql.Tx, table string, requests []InsertRequest) ([]RejectedRequest, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	rows := make([]map[string]any, len(requests))
+	for i, req := range requests {
+		rows[i] = req.Data
+	}
+
+	var err error
+	if requests[0].Delete {
+		err = dc.deleteFromDbBatch(tx, table, rows)
+	} else {
+		err = dc.writeToDbBatch(tx, table, rows)
+	}
+
+	if err == nil {
+		return nil, nil
+	}
+
+	if isNoSuchTable(err) {
+		return nil, &missingTableError{table: table, err: err}
+	}
+
+	if isUnknownColumn(err) {
+		dc.forgetColumns(table)
+
+		// 未开启 mysql_add_columns 时不修改表结构；同一分组内各行的列相同，整组转入失败处理
+		if !config.GetBaseConfig().MysqlAddColumns {
+			rejected := make([]RejectedRequest, len(requests))
+			for i, req := range requests {
+				rejected[i] = RejectedRequest{Request: req, Err: err}
+			}
+
+			return rejected, nil
+		}
+	}
+
+	if !isDataError(err) {
+		return nil, err
+	}
+
+	if len(requests) == 1 {
+		return []RejectedRequest{{Request: requests[0], Err: err}}, nil
+	}
+
+	mid := len(requests) / 2
+	left, err := dc.writeIsolated(tx, table, requests[:mid])
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := dc.writeIsolated(tx, table, requests[mid:])
+	if err != nil {
+		return nil, err
+	}
+
+	return append(left, right...), nil
+}
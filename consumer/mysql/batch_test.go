@@ -0,0 +1,86 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"testing"
+)
+
+func TestIsDataError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"重复键", &mysqlDriver.MySQLError{Number: 1062}, true},
+		{"超出范围", &mysqlDriver.MySQLError{Number: 1264}, true},
+		{"非法值", fmt.Errorf("写入失败：%w", &mysqlDriver.MySQLError{Number: 1366}), true},
+		{"过长", &mysqlDriver.MySQLError{Number: 1406}, true},
+		{"非空", &mysqlDriver.MySQLError{Number: 1048}, true},
+		{"标识符", &IdentifierError{Kind: "列名", Name: "a`b"}, true},
+		{"权限", &mysqlDriver.MySQLError{Number: 1142}, false},
+		{"未知列", &mysqlDriver.MySQLError{Number: 1054}, false},
+		{"语法", &mysqlDriver.MySQLError{Number: 1064}, false},
+		{"死锁", &mysqlDriver.MySQLError{Number: 1213}, false},
+		{"连接", errors.New("invalid connection"), false},
+		{"参数类型", fmt.Errorf("Failed to write to port: %w", errors.New("sql: converting argument $2 type: unsupported type map[string]interface {}, a map")), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDataError(tt.err); got != tt.want {
+				t.Errorf("isDataError(%v) = %v，期望 %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestBatchIsolatesBadRow(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id"}})
+	server.badValue = "bad"
+	client := newTestClient(db)
+
+	var requests []InsertRequest
+	for i := 0; i < 7; i++ {
+		requests = append(requests, InsertRequest{Table: "port", Data: map[string]any{"id": int64(i)}})
+	}
+
+	requests[5].Data["id"] = "bad"
+
+	rejected, err := client.RequestBatch(&requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rejected) != 1 || rejected[0].Request.Data["id"] != "bad" {
+		t.Fatalf("应只返回出错的行：%v", rejected)
+	}
+
+	var mysqlErr *mysqlDriver.MySQLError
+	if !errors.As(rejected[0].Err, &mysqlErr) || mysqlErr.Number != 1366 {
+		t.Fatalf("失败原因不符：%v", rejected[0].Err)
+	}
+
+	// 其余各行恰好写入一次
+	written := make(map[any]int)
+	for _, value := range server.inserted {
+		written[value]++
+	}
+
+	for i, req := range requests {
+		if i == 5 {
+			continue
+		}
+
+		if count := written[req.Data["id"]]; count != 1 {
+			t.Errorf("第 %d 行写入 %d 次", i, count)
+		}
+	}
+
+	if len(written) != len(requests)-1 {
+		t.Errorf("写入的行不符：%v", written)
+	}
+}
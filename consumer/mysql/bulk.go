@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"bufio"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"venu-data/config"
+)
+
+const (
+	bulkModeReplace = "replace"
+	bulkModeIgnore  = "ignore"
+)
+
+var bulkLoadSeq atomic.Uint64
+
+// bulkLoadRule 返回匹配的批量导入规则，未配置时返回 nil
+func bulkLoadRule(db string, table string) *config.BulkLoadRule {
+	rules := config.GetMysqlBulkLoadRules()
+	for i := range rules {
+		rule := &rules[i]
+		dbMatched, _ := path.Match(rule.Db, db)
+		tableMatched, _ := path.Match(rule.Table, table)
+		if dbMatched && tableMatched {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// loadDataBatch 通过 LOAD DATA LOCAL INFILE 写入，数据以 CSV 流的形式经 Reader 处理器发送，
+// 需要服务端开启 local_infile。replace 模式下未提供的列取默认值，这与 upsert 不同。
+func (dc *Client) loadDataBatch(executor sqlExecutor, table string, columns []string, data []map[string]any, mode string) error {
+	var modeKeyword string
+	switch strings.ToLower(mode) {
+	case bulkModeReplace:
+		modeKeyword = "REPLACE"
+	case bulkModeIgnore:
+		modeKeyword = "IGNORE"
+	default:
+		// 配置加载时已校验 mode，见 config.validateMysqlBulkLoad
+		return fmt.Errorf("不支持的批量导入模式：%s", mode)
+	}
+
+	name := fmt.Sprintf("venus_data_%d", bulkLoadSeq.Add(1))
+	mysqlDriver.RegisterReaderHandler(name, func() io.Reader {
+		return newCsvReader(columns, data)
+	})
+	defer mysqlDriver.DeregisterReaderHandler(name)
+
+	//noinspection ALL
+	stmt := fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%s' %s INTO TABLE %s CHARACTER SET utf8mb4 "+
+		"FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '\"' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%s)",
+		name, modeKeyword, quoteTable(dc.database, table), strings.Join(quoteIdentifiers(columns), ", "))
+
+	if dc.debug && dc.sqlDebug {
+		dc.dbLog.D("loadDataBatch exec: %s, rows: %d", stmt, len(data))
+	}
+
+	_, err := executor.Exec(stmt)
+	return err
+}
+
+// newCsvReader 边编码边发送，驱动读完或出错时会关闭 Reader，写端随之退出
+func newCsvReader(columns []string, data []map[string]any) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(writer)
+		var err error
+		for _, row := range data {
+			for i, column := range columns {
+				if i > 0 {
+					_ = w.WriteByte(',')
+				}
+
+				writeCsvValue(w, row[column])
+			}
+
+			if err = w.WriteByte('\n'); err != nil {
+				break
+			}
+		}
+
+		if err == nil {
+			err = w.Flush()
+		}
+
+		_ = writer.CloseWithError(err)
+	}()
+
+	return reader
+}
+
+// writeCsvValue NULL 写为 \N，字符串加引号并转义反斜杠、引号和 NUL
+func writeCsvValue(w *bufio.Writer, value any) {
+	switch v := value.(type) {
+	case nil:
+		_, _ = w.WriteString(`\N`)
+	case bool:
+		if v {
+			_ = w.WriteByte('1')
+		} else {
+			_ = w.WriteByte('0')
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		_, _ = fmt.Fprint(w, v)
+	case float32:
+		_, _ = w.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		_, _ = w.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		writeCsvString(w, v.Format("2006-01-02 15:04:05.999999"))
+	case []byte:
+		writeCsvString(w, string(v))
+	case string:
+		writeCsvString(w, v)
+	default:
+		writeCsvString(w, fmt.Sprint(v))
+	}
+}
+
+func writeCsvString(w *bufio.Writer, s string) {
+	_ = w.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			_ = w.WriteByte('\\')
+			_ = w.WriteByte(c)
+		case 0:
+			_, _ = w.WriteString(`\0`)
+		default:
+			_ = w.WriteByte(c)
+		}
+	}
+	_ = w.WriteByte('"')
+}
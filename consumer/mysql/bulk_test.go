@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"io"
+	"os"
+	"testing"
+)
+
+const benchRows = 5000
+
+var benchColumns = []string{"hostname", "ifname", "in_octets", "out_octets", "speed", "status"}
+
+func benchData() []map[string]any {
+	rows := make([]map[string]any, benchRows)
+	for i := range rows {
+		rows[i] = map[string]any{
+			"hostname":   fmt.Sprintf("switch-%03d", i/48),
+			"ifname":     fmt.Sprintf("eth%d", i%48),
+			"in_octets":  int64(i) * 1024,
+			"out_octets": int64(i) * 2048,
+			"speed":      1.5e9,
+			"status":     "up",
+		}
+	}
+
+	return rows
+}
+
+// BenchmarkEncode 客户端编码开销：LOAD DATA 的 CSV 流与 INSERT 语句及参数
+func BenchmarkEncode(b *testing.B) {
+	loadTestConfig(b, nil)
+	data := benchData()
+
+	b.Run("bulk", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := io.Copy(io.Discard, newCsvReader(benchColumns, data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("insert", func(b *testing.B) {
+		db, _ := newFakeDb(b, map[string][]string{"bench": benchColumns})
+		client := newTestClient(db)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := client.writeColumnGroup(db, "bench", benchColumns, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkWrite 在真实 MySQL 上比较两种写入方式，需设置 VENUS_MYSQL_TEST_DSN，
+// 如 user:pwd@tcp(127.0.0.1:3306)/bench，服务端需开启 local_infile
+func BenchmarkWrite(b *testing.B) {
+	dsn := os.Getenv("VENUS_MYSQL_TEST_DSN")
+	if dsn == "" {
+		b.Skip("未设置 VENUS_MYSQL_TEST_DSN")
+	}
+
+	dsnConfig, err := mysqlDriver.ParseDSN(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	loadTestConfig(b, map[string]any{
+		"mysql_bulk_load": []map[string]any{{"db": dsnConfig.DBName, "table": "bench_bulk", "mode": "replace", "min_rows": 1}},
+	})
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer func() {
+		_ = db.Close()
+	}()
+
+	client := newTestClient(db)
+	client.database = dsnConfig.DBName
+	client.loadMaxAllowedPacket()
+	data := benchData()
+
+	for _, table := range []string{"bench_insert", "bench_bulk"} {
+		//noinspection ALL
+		_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + quoteIdentifier(table) + " (hostname VARCHAR(180), ifname VARCHAR(180), " +
+			"in_octets BIGINT, out_octets BIGINT, speed DOUBLE, status VARCHAR(255), PRIMARY KEY (hostname, ifname))")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(table, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := client.writeColumnGroup(db, table, benchColumns, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(b.N*benchRows)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	prettyLog "github.com/my-dev-lib/pretty-log-go"
+	"sort"
+	"strconv"
+	"strings"
+	"venu-data/config"
+	"venu-data/consumer/base"
+)
+
+const (
+	cdcOpCreate   = "c"
+	cdcOpUpdate   = "u"
+	cdcOpDelete   = "d"
+	cdcOpSnapshot = "r"
+	cdcOpTruncate = "t"
+)
+
+// CdcSource Debezium 事件中的 source 块，只取路由需要的字段
+type CdcSource struct {
+	Db    string `json:"db"`
+	Table string `json:"table"`
+}
+
+// CdcEnvelope Debezium JSON 格式的变更事件
+type CdcEnvelope struct {
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+	Source CdcSource      `json:"source"`
+	Op     string         `json:"op"`
+	TsMs   int64          `json:"ts_ms"`
+}
+
+// cdcWrapper 开启 schemas.enable 时事件被包在 payload 中
+type cdcWrapper struct {
+	Schema  json.RawMessage `json:"schema"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type CdcReaderConsumer struct {
+	log     *prettyLog.Log
+	topic   string
+	groupId string
+	id      string
+}
+
+func NewMysqlCdcReaderConsumer(topicConf config.TopicConfig) *CdcReaderConsumer {
+	return &CdcReaderConsumer{
+		log:     prettyLog.NewLog("MCDC"),
+		topic:   topicConf.Name,
+		groupId: topicConf.GroupID,
+		id:      topicConf.GroupID + "_" + uuid.New().String(),
+	}
+}
+
+func (cc *CdcReaderConsumer) Topic() string {
+	return cc.topic
+}
+
+func (cc *CdcReaderConsumer) GroupId() string {
+	return cc.groupId
+}
+
+func (cc *CdcReaderConsumer) Id() string {
+	return cc.id
+}
+
+func (cc *CdcReaderConsumer) handle(event *CdcEnvelope, key map[string]any) error {
+	dbName := event.Source.Db
+	table := event.Source.Table
+	if err := ValidateIdentifier("库名", dbName); err != nil {
+		return err
+	}
+
+	if err := ValidateIdentifier("表名", table); err != nil {
+		return err
+	}
+
+	pool := obtainPool(dbName)
+
+	switch event.Op {
+	case cdcOpCreate, cdcOpUpdate, cdcOpSnapshot:
+		if event.After == nil {
+			return fmt.Errorf("CDC 事件 op=%s 缺少 after：%s.%s", event.Op, dbName, table)
+		}
+
+		err := pool.ensureTable(table, func() string {
+			return GetMysqlCreateTableSqlUnionKey(table, event.After, nil, cdcKeyColumns(key))
+		})
+		if err != nil {
+			cc.log.E("创建数据库%s表%s失败: %v", dbName, table, err)
+		}
+
+		return pool.upsertToMysqlDb(table, event.After, cdcRouteKey(table, key))
+	case cdcOpDelete:
+		row := key
+		if len(row) == 0 {
+			row = event.Before
+		}
+
+		if len(row) == 0 {
+			return fmt.Errorf("CDC 删除事件缺少 key 和 before：%s.%s", dbName, table)
+		}
+
+		return pool.deleteFromMysqlDb(table, row, cdcLocateRow(row, event.Before), cdcRouteKey(table, key))
+	case cdcOpTruncate:
+		cc.log.W("忽略 truncate 事件：%s.%s", dbName, table)
+		return nil
+	default:
+		return fmt.Errorf("不支持的 CDC 操作类型：%s", event.Op)
+	}
+}
+
+func (cc *CdcReaderConsumer) Consume(msg *base.DataMessage) error {
+	// 墓碑消息只用于 Kafka 日志压缩，对应的删除已在前一条事件中处理
+	payload, err := unwrapCdcPayload(msg.Value)
+	if err != nil {
+		return fmt.Errorf("#CdcReaderConsumer.Consume json 解析错误：%v", err)
+	}
+
+	if payload == nil {
+		return nil
+	}
+
+	var event CdcEnvelope
+	err = unmarshalCdc(payload, &event)
+	if err != nil {
+		return fmt.Errorf("#CdcReaderConsumer.Consume json 解析错误：%v", err)
+	}
+
+	key, err := decodeCdcKey(msg.Key)
+	if err != nil {
+		cc.log.W("CDC 消息 key 解析失败，改用 before/after：%v", err)
+	}
+
+	err = normalizeCdcRows(&event, &key)
+	if err != nil {
+		return fmt.Errorf("#CdcReaderConsumer.Consume 消息校验失败：%v", err)
+	}
+
+	err = cc.handle(&event, key)
+	if err != nil {
+		return fmt.Errorf("#CdcReaderConsumer.Consume 处理失败：%v", err)
+	}
+
+	return nil
+}
+
+// unwrapCdcPayload 返回事件本体，墓碑消息返回 nil
+func unwrapCdcPayload(value []byte) ([]byte, error) {
+	if isJsonNull(value) {
+		return nil, nil
+	}
+
+	var wrapper cdcWrapper
+	err := json.Unmarshal(value, &wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	if wrapper.Schema == nil && wrapper.Payload == nil {
+		return value, nil
+	}
+
+	if isJsonNull(wrapper.Payload) {
+		return nil, nil
+	}
+
+	return wrapper.Payload, nil
+}
+
+// decodeCdcKey 解析 Debezium 消息 key，得到主键列及其取值
+func decodeCdcKey(value []byte) (map[string]any, error) {
+	payload, err := unwrapCdcPayload(value)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+
+	var key map[string]any
+	err = unmarshalCdc(payload, &key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// unmarshalCdc 数值按 json.Number 解析，避免大整数主键经过 float64 丢失精度
+func unmarshalCdc(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// cdcNumber 整数转为 int64（超出范围时为 uint64），其余转为 float64，建表时分别对应 BIGINT 和 FLOAT
+func cdcNumber(n json.Number) any {
+	if v, err := n.Int64(); err == nil {
+		return v
+	}
+
+	if v, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return v
+	}
+
+	if v, err := n.Float64(); err == nil {
+		return v
+	}
+
+	return n.String()
+}
+
+// normalizeCdcRows 规整并校验事件中各行的列名，并转换数值类型
+func normalizeCdcRows(event *CdcEnvelope, key *map[string]any) error {
+	for _, row := range []*map[string]any{&event.Before, &event.After, key} {
+		if *row == nil {
+			continue
+		}
+
+		normalized, err := normalizeColumns(*row)
+		if err != nil {
+			return err
+		}
+
+		for column, value := range normalized {
+			if n, ok := value.(json.Number); ok {
+				normalized[column] = cdcNumber(n)
+			}
+		}
+
+		*row = normalized
+	}
+
+	return nil
+}
+
+func cdcKeyColumns(key map[string]any) []string {
+	var columns []string
+	for column := range key {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+	return columns
+}
+
+// cdcLocateRow 删除事件的 key 只含主键，分片键和分区列不在主键中时从 before 补齐，key 中的值优先
+func cdcLocateRow(key map[string]any, before map[string]any) map[string]any {
+	row := make(map[string]any, len(key)+len(before))
+	for column, value := range before {
+		row[column] = value
+	}
+
+	for column, value := range key {
+		row[column] = value
+	}
+
+	return row
+}
+
+// cdcRouteKey 同一行的事件必须由同一个处理器按顺序写入，因此只按消息 key 中的主键列路由；
+// 没有 key 时无法确定主键，整张表交给同一个处理器
+func cdcRouteKey(table string, key map[string]any) string {
+	columns := make([]string, 0, len(key))
+	for column := range key {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+
+	var sb strings.Builder
+	sb.WriteString(table)
+	for _, column := range columns {
+		sb.WriteString(fmt.Sprintf("|%s=%v", column, key[column]))
+	}
+
+	return sb.String()
+}
+
+func isJsonNull(value []byte) bool {
+	trimmed := strings.TrimSpace(string(value))
+	return trimmed == "" || trimmed == "null"
+}
@@ -0,0 +1,274 @@
+package mysql
+
+import (
+	"fmt"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"github.com/segmentio/kafka-go"
+	"reflect"
+	"testing"
+	"venu-data/config"
+	"venu-data/consumer/base"
+)
+
+// newCapturePool 注册到连接池表中但不启动处理器的连接池，投递的请求留在各处理器的通道中供检查
+func newCapturePool(t *testing.T, dbName string, size int) *Pool {
+	t.Helper()
+
+	db, _ := newFakeDb(t, nil)
+	endpoint, _ := config.ResolveMysqlEndpoint(dbName)
+	mdp := &Pool{
+		dbHandlers: make([]*Handler, size),
+		dbInfo:     &DbInfo{name: dbName},
+		endpoint:   endpoint,
+		closing:    make(chan struct{}),
+		stop:       make(chan struct{}),
+		log:        log.NewLog("TEST"),
+	}
+
+	hosts := obtainHostGroup([]string{"fake:0"}, "test", "test", config.MysqlTlsConfig{})
+	for i := range mdp.dbHandlers {
+		client := newTestClient(db)
+		client.hosts = hosts
+		client.status.Store(dbStatusOk)
+		mdp.dbHandlers[i] = &Handler{client: client, channel: make(chan InsertRequest, 100)}
+	}
+
+	key := endpoint + "/" + dbName
+	poolLock.Lock()
+	sharedDbPool[key] = mdp
+	poolLock.Unlock()
+
+	t.Cleanup(func() {
+		poolLock.Lock()
+		delete(sharedDbPool, key)
+		poolLock.Unlock()
+
+		schemaLock.Lock()
+		schemaCache = make(map[string]*tableSchema)
+		schemaLock.Unlock()
+	})
+
+	return mdp
+}
+
+// drain 取出各处理器通道中的请求，返回请求及其所在的处理器序号
+func (mdp *Pool) drain() ([]InsertRequest, []int) {
+	var requests []InsertRequest
+	var handlers []int
+	for i, handler := range mdp.dbHandlers {
+		for len(handler.channel) > 0 {
+			requests = append(requests, <-handler.channel)
+			handlers = append(handlers, i)
+		}
+	}
+
+	return requests, handlers
+}
+
+func cdcMessage(key string, value string) *base.DataMessage {
+	msg := kafka.Message{Value: []byte(value)}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+
+	return &base.DataMessage{Message: msg}
+}
+
+func TestCdcConsume(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  []InsertRequest
+	}{
+		{
+			name:  "新增",
+			key:   `{"id":1}`,
+			value: `{"op":"c","source":{"db":"inventory","table":"customers"},"after":{"id":1,"name":"a"}}`,
+			want:  []InsertRequest{{Table: "customers", Data: map[string]any{"id": int64(1), "name": "a"}}},
+		},
+		{
+			name:  "schema 包装",
+			key:   `{"schema":{"type":"struct"},"payload":{"id":2}}`,
+			value: `{"schema":{"type":"struct"},"payload":{"op":"u","source":{"db":"inventory","table":"customers"},"before":{"id":2,"name":"a"},"after":{"id":2,"name":"b"}}}`,
+			want:  []InsertRequest{{Table: "customers", Data: map[string]any{"id": int64(2), "name": "b"}}},
+		},
+		{
+			name:  "快照",
+			value: `{"op":"r","source":{"db":"inventory","table":"customers"},"after":{"id":3,"name":"c"}}`,
+			want:  []InsertRequest{{Table: "customers", Data: map[string]any{"id": int64(3), "name": "c"}}},
+		},
+		{
+			name:  "按 key 删除",
+			key:   `{"schema":{"type":"struct"},"payload":{"id":4}}`,
+			value: `{"op":"d","source":{"db":"inventory","table":"customers"},"before":{"id":4,"name":"d"}}`,
+			want:  []InsertRequest{{Table: "customers", Data: map[string]any{"id": int64(4)}, Delete: true}},
+		},
+		{
+			name:  "没有 key 时按 before 删除",
+			value: `{"op":"d","source":{"db":"inventory","table":"customers"},"before":{"id":5,"name":"e"}}`,
+			want:  []InsertRequest{{Table: "customers", Data: map[string]any{"id": int64(5), "name": "e"}, Delete: true}},
+		},
+		{
+			name:  "墓碑",
+			key:   `{"id":4}`,
+			value: ``,
+		},
+		{
+			name:  "payload 为 null 的墓碑",
+			key:   `{"id":4}`,
+			value: `{"schema":null,"payload":null}`,
+		},
+		{
+			name:  "truncate",
+			value: `{"op":"t","source":{"db":"inventory","table":"customers"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newCapturePool(t, "inventory", 4)
+			consumer := NewMysqlCdcReaderConsumer(config.TopicConfig{Name: "cdc", GroupID: "cdc"})
+
+			if err := consumer.Consume(cdcMessage(tt.key, tt.value)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, _ := pool.drain()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("请求 %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCdcConsumeRejectsInvalidEvents(t *testing.T) {
+	loadTestConfig(t, nil)
+	newCapturePool(t, "inventory", 1)
+	consumer := NewMysqlCdcReaderConsumer(config.TopicConfig{Name: "cdc", GroupID: "cdc"})
+
+	for _, value := range []string{
+		`{"op":"c",`,
+		`{"op":"c","source":{"db":"inventory","table":"customers"}}`,
+		`{"op":"d","source":{"db":"inventory","table":"customers"}}`,
+		`{"op":"x","source":{"db":"inventory","table":"customers"},"after":{"id":1}}`,
+		"{\"op\":\"c\",\"source\":{\"db\":\"inventory\",\"table\":\"a`b\"},\"after\":{\"id\":1}}",
+	} {
+		if err := consumer.Consume(cdcMessage("", value)); err == nil {
+			t.Errorf("应拒绝：%s", value)
+		}
+	}
+}
+
+// 同一主键的写入与删除落到同一个处理器，before/after 中的其他列不影响路由
+func TestCdcDeleteRoutesWithUpsert(t *testing.T) {
+	loadTestConfig(t, nil)
+	pool := newCapturePool(t, "inventory", 8)
+	consumer := NewMysqlCdcReaderConsumer(config.TopicConfig{Name: "cdc", GroupID: "cdc"})
+
+	for id := 0; id < 32; id++ {
+		key := fmt.Sprintf(`{"schema":{"type":"struct"},"payload":{"id":%d}}`, id)
+		upsert := fmt.Sprintf(`{"op":"u","source":{"db":"inventory","table":"customers"},"after":{"id":%d,"name":"new-%d"}}`, id, id)
+		remove := fmt.Sprintf(`{"op":"d","source":{"db":"inventory","table":"customers"},"before":{"id":%d,"name":"old"}}`, id)
+
+		for _, value := range []string{upsert, remove} {
+			if err := consumer.Consume(cdcMessage(key, value)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	requests, handlers := pool.drain()
+	routes := make(map[any]int)
+	used := make(map[int]bool)
+	for i, req := range requests {
+		id := req.Data["id"]
+		if handler, ok := routes[id]; ok && handler != handlers[i] {
+			t.Fatalf("id=%v 的写入和删除落到不同的处理器：%d, %d", id, handler, handlers[i])
+		}
+
+		routes[id] = handlers[i]
+		used[handlers[i]] = true
+	}
+
+	if len(requests) != 64 {
+		t.Fatalf("请求数 %d，期望 64", len(requests))
+	}
+
+	if len(used) < 2 {
+		t.Errorf("不同主键应分散到多个处理器：%v", used)
+	}
+}
+
+func TestDecodeCdcKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want map[string]any
+		ok   bool
+	}{
+		{"无 key", "", nil, true},
+		{"null", "null", nil, true},
+		{"直接的主键", `{"id":9007199254740993}`, map[string]any{"id": "9007199254740993"}, true},
+		{"schema 包装", `{"schema":{"type":"struct"},"payload":{"id":1,"region":"eu"}}`, map[string]any{"id": "1", "region": "eu"}, true},
+		{"格式错误", `{"id":`, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := decodeCdcKey([]byte(tt.key))
+			if (err == nil) != tt.ok {
+				t.Fatalf("错误：%v", err)
+			}
+
+			// 数值保留为 json.Number，按字符串比较
+			got := make(map[string]any)
+			for column, value := range key {
+				got[column] = fmt.Sprint(value)
+			}
+
+			if tt.want == nil && len(key) != 0 || tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("key %v，期望 %v", key, tt.want)
+			}
+		})
+	}
+}
+
+func TestCdcNumbersKeepPrecision(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	payload := []byte(`{"op":"c","source":{"db":"d","table":"t"},"after":{"id":9007199254740993,"big":18446744073709551615,"ratio":1.5}}`)
+
+	var event CdcEnvelope
+	if err := unmarshalCdc(payload, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	key := map[string]any{}
+	if err := normalizeCdcRows(&event, &key); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		column  string
+		value   any
+		sqlType string
+	}{
+		{"id", int64(9007199254740993), "BIGINT"},
+		{"big", uint64(18446744073709551615), "BIGINT UNSIGNED"},
+		{"ratio", 1.5, "FLOAT"},
+	}
+
+	for _, tt := range tests {
+		value := event.After[tt.column]
+		if value != tt.value {
+			t.Errorf("%s = %#v，期望 %#v", tt.column, value, tt.value)
+		}
+
+		if got := getColumnType(value, true); got != tt.sqlType {
+			t.Errorf("%s 列类型 %s，期望 %s", tt.column, got, tt.sqlType)
+		}
+	}
+}
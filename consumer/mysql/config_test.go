@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"venu-data/config"
+)
+
+// loadTestConfig 以默认配置为基础加载测试配置，overrides 中的 base 与默认 base 合并，其余键直接覆盖
+func loadTestConfig(t testing.TB, overrides map[string]any) {
+	t.Helper()
+
+	base := map[string]any{
+		"mysql_pool_size":          10,
+		"mysql_max_buffer_size":    100,
+		"mysql_max_interval_time":  30,
+		"mysql_pool_channel_size":  100,
+		"mysql_max_open_conns":     10,
+		"mysql_max_idle_conns":     2,
+		"influx_pool_size":         1,
+		"influx_max_buffer_size":   5000,
+		"influx_max_interval_time": 30,
+		"influx_pool_channel_size": 100,
+	}
+
+	content := map[string]any{"base": base}
+	for key, value := range overrides {
+		if key == "base" {
+			for k, v := range value.(map[string]any) {
+				base[k] = v
+			}
+
+			continue
+		}
+
+		content[key] = value
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = config.LoadConfigFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = config.Init("127.0.0.1:9092", "127.0.0.1:3306@test/test", "127.0.0.1:8086"); err != nil {
+		t.Fatal(err)
+	}
+}
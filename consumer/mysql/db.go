@@ -6,10 +6,12 @@ import (
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	log "github.com/my-dev-lib/pretty-log-go"
+	"net"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
-	"time"
+	"venu-data/config"
 )
 
 const (
@@ -21,43 +23,72 @@ const (
 type InsertRequest struct {
 	Table string
 	Data  map[string]any
+	// Delete 为 true 时按 Data 中的键值删除对应行
+	Delete bool
 }
 
 type Client struct {
-	dbClient *sql.DB
-	status   atomic.Uint32
-	lock     sync.Mutex
+	dbClient  *sql.DB
+	source    string
+	maxPacket int
+	status    atomic.Uint32
+	lock      sync.Mutex
+	// closed 为 true 后不再连接，避免关闭后重新占用共享的 sql.DB
+	closed bool
+
+	// columns 已知的各表列名（小写），写入前据此补齐新列
+	columns    map[string]map[string]bool
+	columnLock sync.Mutex
 
 	database string
-	host     string
-	port     string
 	user     string
 	pwd      string
+	// hosts 候选地址，address 和 generation 为本次连接的地址及主库版本
+	hosts      *hostGroup
+	address    string
+	generation atomic.Uint64
 
 	debug    bool
 	sqlDebug bool
 	dbLog    *log.Log
 }
 
-func NewClient(database string, host string, port string, user string, pwd string, debug bool) *Client {
+func NewClient(database string, addresses []string, user string, pwd string, tls config.MysqlTlsConfig, debug bool) *Client {
 	dbLog := log.NewLog("MDC")
 	dbLog.SetFlag(log.FlagColorEnabled)
 	return &Client{
 		database: database,
-		host:     host,
-		port:     port,
+		hosts:    obtainHostGroup(addresses, user, pwd, tls),
 		user:     user,
 		pwd:      pwd,
 		dbLog:    dbLog,
 		debug:    debug,
+		columns:  make(map[string]map[string]bool),
 	}
 }
 
 func (dc *Client) connDb() error {
-	sourcePrefix := "%s:%s@tcp(%s:%s)/"
-	source := fmt.Sprintf(sourcePrefix, dc.user, dc.pwd, dc.host, dc.port)
+	if err := ValidateIdentifier("库名", dc.database); err != nil {
+		return err
+	}
+
+	address, generation, err := dc.hosts.primary()
+	if err != nil {
+		return err
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	source, err := buildDataSource(dc.user, dc.pwd, host, port, "", dc.hosts.tls)
+	if err != nil {
+		return err
+	}
+
 	if dc.debug {
-		dc.dbLog.D("ConnDb open %s", source)
+		dc.dbLog.D("ConnDb open %s@%s", dc.user, address)
 	}
 
 	db, err := sql.Open("mysql", source)
@@ -68,29 +99,69 @@ func (dc *Client) connDb() error {
 	dc.dbClient = db
 	err = dc.initDb()
 	if err != nil {
+		_ = db.Close()
+		dc.dbClient = nil
+		dc.hosts.invalidate(address)
 		return err
 	}
 
 	_ = db.Close()
 
-	source = fmt.Sprintf(sourcePrefix+"%s", dc.user, dc.pwd, dc.host, dc.port, dc.database)
-	db, err = sql.Open("mysql", source)
+	// 同一数据源的 Client 共用 sql.DB，连接池参数及全局预算见 openSharedDb
+	source, err = buildDataSource(dc.user, dc.pwd, host, port, dc.database, dc.hosts.tls)
 	if err != nil {
 		return err
 	}
 
+	db, err = openSharedDb(source)
+	if err != nil {
+		dc.dbClient = nil
+		return err
+	}
+
 	// 设置数据库客户端
 	dc.dbClient = db
-	// 设置连接池参数
-	db.SetMaxOpenConns(100) // 最大打开连接数
-	db.SetMaxIdleConns(10)  // 最大空闲连接数
-	db.SetConnMaxLifetime(2 * time.Minute)
-	return db.Ping()
+	dc.source = source
+	dc.address = address
+	dc.generation.Store(generation)
+	err = db.Ping()
+	if err != nil {
+		dc.release()
+		dc.hosts.invalidate(address)
+		return err
+	}
+
+	dc.loadMaxAllowedPacket()
+	return nil
+}
+
+func (dc *Client) release() {
+	dc.columnLock.Lock()
+	dc.columns = make(map[string]map[string]bool)
+	dc.columnLock.Unlock()
+	if dc.source != "" {
+		releaseSharedDb(dc.source)
+		dc.source = ""
+	}
+
+	dc.dbClient = nil
+}
+
+var errClientClosed = errors.New("客户端已关闭")
+
+// Close 释放共享的 sql.DB，之后 Init 返回 errClientClosed
+func (dc *Client) Close() {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.closed = true
+	dc.release()
+	dc.status.Store(0)
 }
 
 func (dc *Client) initDb() error {
 	//noinspection ALL
-	query := "create database if not exists " + dc.database
+	query := "create database if not exists " + quoteIdentifier(dc.database)
 	if dc.debug {
 		dc.dbLog.D("initDb exec %s", query)
 	}
@@ -99,7 +170,34 @@ func (dc *Client) initDb() error {
 	return err
 }
 
+// MarkFailed 写入失败后调用，连接可能已指向旧主库，下次 Init 重新探测并重连
+func (dc *Client) MarkFailed(err error) {
+	if !needsFailover(err) {
+		return
+	}
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if dc.address != "" {
+		dc.hosts.invalidate(dc.address)
+	}
+
+	if dc.status.Load() == dbStatusOk {
+		dc.status.Store(dbStatusErr)
+	}
+}
+
 func (dc *Client) Init() error {
+	// 主库切换后，已连接的 Client 也需要重连
+	if dc.status.Load() == dbStatusOk && dc.generation.Load() != dc.hosts.currentGeneration() {
+		dc.lock.Lock()
+		if dc.status.Load() == dbStatusOk {
+			dc.status.Store(dbStatusErr)
+		}
+		dc.lock.Unlock()
+	}
+
 	if dc.status.Load() == dbStatusOk {
 		return nil
 	}
@@ -119,13 +217,18 @@ func (dc *Client) Init() error {
 		return errors.New("mysqldb init")
 	}
 
+	if dc.closed {
+		return errClientClosed
+	}
+
 	dc.status.Store(dbStatusInit)
+	dc.release()
 	if err := dc.connDb(); err == nil {
 		dc.status.Store(dbStatusOk)
 		return nil
 	} else {
 		dc.status.Store(dbStatusErr)
-		return errors.New("mysqldb init error")
+		return fmt.Errorf("mysqldb init error: %w", err)
 	}
 }
 
@@ -137,26 +240,35 @@ func (dc *Client) QueryRow(query string, args ...interface{}) *sql.Row {
 	return dc.dbClient.QueryRow(query, args...)
 }
 
-func (dc *Client) Query(table string, names []string, filter string) ([]map[string]any, error) {
+// Query 查询表数据，filter 中的取值应使用占位符并通过 args 传入
+func (dc *Client) Query(table string, names []string, filter string, args ...any) ([]map[string]any, error) {
+	if err := ValidateIdentifier("表名", table); err != nil {
+		return nil, err
+	}
+
+	if err := validateColumns(names); err != nil {
+		return nil, err
+	}
+
 	var selectColumns string
 	if names == nil || len(names) <= 0 {
 		selectColumns = "*"
 	} else {
-		selectColumns = strings.Join(names, ", ")
+		selectColumns = strings.Join(quoteIdentifiers(names), ", ")
 	}
 
 	//noinspection ALL
-	querySql := fmt.Sprintf("select %s from %s.%s", selectColumns, dc.database, table)
+	querySql := fmt.Sprintf("select %s from %s", selectColumns, quoteTable(dc.database, table))
 
 	if filter != "" {
 		querySql += " WHERE " + filter
 	}
 
 	if dc.debug && dc.sqlDebug {
-		dc.dbLog.D("Query exec: %s", querySql)
+		dc.dbLog.D("Query exec: %s, values: %v", querySql, args)
 	}
 
-	rows, err := dc.dbClient.Query(querySql)
+	rows, err := dc.dbClient.Query(querySql, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -205,57 +317,117 @@ func (dc *Client) Query(table string, names []string, filter string) ([]map[stri
 }
 
 func (dc *Client) WriteToDbBatch(table string, data []map[string]any) error {
+	if err := dc.ensureColumns(table, data); err != nil {
+		return err
+	}
+
+	return dc.writeToDbBatch(dc.dbClient, table, data)
+}
+
+func (dc *Client) writeToDbBatch(executor sqlExecutor, table string, data []map[string]any) error {
 	if len(data) == 0 {
 		return nil
 	}
 
-	var columns []string
-	for column := range data[0] {
-		column = fixDbName(column)
-		columns = append(columns, column)
+	if err := ValidateIdentifier("表名", table); err != nil {
+		return err
 	}
 
-	var placeholderGroups []string
-	var updates []string
-	var values []interface{}
-	for _, column := range columns {
-		updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", column, column))
+	// 同一批次中各行的列可能不同，按列集合分组分别写入：
+	// 多出的列不会被丢弃，upsert 时缺少的列保留原值而不是被 NULL 覆盖
+	for _, group := range groupByColumns(data) {
+		err := dc.writeColumnGroup(executor, table, group.columns, group.rows)
+		if err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+func (dc *Client) writeColumnGroup(executor sqlExecutor, table string, columns []string, data []map[string]any) error {
+	if err := validateColumns(columns); err != nil {
+		return err
+	}
+
+	// 配置了批量导入且行数足够时走 LOAD DATA，报文由驱动分块发送
+	if rule := bulkLoadRule(dc.database, table); rule != nil && len(data) >= rule.MinRows {
+		return dc.loadDataBatch(executor, table, columns, data, rule.Mode)
+	}
+
+	// 按 max_allowed_packet 和占位符上限拆成多条语句
+	chunks, err := dc.splitByLimits(columns, data)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		err = dc.execInsert(executor, table, columns, chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dc *Client) execInsert(executor sqlExecutor, table string, columns []string, data []map[string]any) error {
+	var values []interface{}
 	for _, row := range data {
-		var placeholders []string
 		for _, column := range columns {
 			values = append(values, row[column])
-			placeholders = append(placeholders, "?")
 		}
-
-		placeholderGroups = append(placeholderGroups, fmt.Sprintf("(%s)", strings.Join(placeholders, ", ")))
 	}
 
-	stmt := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
-		dc.database, table, strings.Join(columns, ", "), strings.Join(placeholderGroups, ", "), strings.Join(updates, ", "))
-
+	stmt := insertStatement(dc.database, table, columns, len(data))
 	if dc.debug && dc.sqlDebug {
 		dc.dbLog.D("WriteToDbBatch exec: %s, values: %v", stmt, values)
 	}
 
-	_, err := dc.dbClient.Exec(stmt, values...)
+	_, err := executor.Exec(stmt, values...)
 	return err
 }
 
+func insertStatement(database string, table string, columns []string, rowCount int) string {
+	var updates []string
+	for _, column := range columns {
+		updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", quoteIdentifier(column), quoteIdentifier(column)))
+	}
+
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+
+	placeholderGroup := fmt.Sprintf("(%s)", strings.Join(placeholders, ", "))
+	placeholderGroups := make([]string, rowCount)
+	for i := range placeholderGroups {
+		placeholderGroups[i] = placeholderGroup
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
+		quoteTable(database, table), strings.Join(quoteIdentifiers(columns), ", "), strings.Join(placeholderGroups, ", "), strings.Join(updates, ", "))
+}
+
 func (dc *Client) WriteToDb(table string, data map[string]any) error {
 	return dc.WriteToDbBatch(table, []map[string]any{data})
 }
 
 func (dc *Client) UpdateDb(table string, data map[string]any, query map[string]any) error {
 	var queryParts []string
+	var queryValues []interface{}
 	for key, val := range query {
-		queryParts = append(queryParts, fmt.Sprintf("%s = '%v'", key, val))
+		if err := ValidateIdentifier("列名", key); err != nil {
+			return err
+		}
+
+		queryParts = append(queryParts, fmt.Sprintf("%s = ?", quoteIdentifier(key)))
+		queryValues = append(queryValues, val)
 	}
 
 	queryStr := strings.Join(queryParts, " AND ")
 
-	results, err := dc.Query(table, nil, queryStr)
+	results, err := dc.Query(table, nil, queryStr, queryValues...)
 	if err != nil {
 		return err
 	}
@@ -269,12 +441,18 @@ func (dc *Client) UpdateDb(table string, data map[string]any, query map[string]a
 	var updateParts []string
 	var values []interface{}
 	for key, val := range data {
-		updateParts = append(updateParts, fmt.Sprintf("%s = ?", key))
+		if err := ValidateIdentifier("列名", key); err != nil {
+			return err
+		}
+
+		updateParts = append(updateParts, fmt.Sprintf("%s = ?", quoteIdentifier(key)))
 		values = append(values, val)
 	}
 
+	values = append(values, queryValues...)
+
 	//noinspection ALL
-	updateSql := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s", dc.database, table, strings.Join(updateParts, ", "), queryStr)
+	updateSql := fmt.Sprintf("UPDATE %s SET %s WHERE %s", quoteTable(dc.database, table), strings.Join(updateParts, ", "), queryStr)
 
 	if dc.debug && dc.sqlDebug {
 		dc.dbLog.D("UpdateDb exec: %s, values: %v", updateSql, values)
@@ -284,49 +462,52 @@ func (dc *Client) UpdateDb(table string, data map[string]any, query map[string]a
 	return err
 }
 
-func (dc *Client) clearInvalidData(table string) error {
-	if dc.database == "venusdb" {
+func (dc *Client) DeleteFromDbBatch(table string, keys []map[string]any) error {
+	return dc.deleteFromDbBatch(dc.dbClient, table, keys)
+}
+
+func (dc *Client) deleteFromDbBatch(executor sqlExecutor, table string, keys []map[string]any) error {
+	if len(keys) == 0 {
 		return nil
 	}
 
-	//noinspection ALL
-	deleteStmt := fmt.Sprintf("DELETE FROM %s.%s WHERE update_at < NOW() - INTERVAL 24 HOUR", dc.database, table)
-	if _, err := dc.dbClient.Exec(deleteStmt); err != nil {
-		dc.dbLog.W("Error deleting old records: %v", err)
+	if err := ValidateIdentifier("表名", table); err != nil {
 		return err
 	}
 
-	return nil
-}
+	var conditions []string
+	var values []interface{}
+	for _, key := range keys {
+		var parts []string
+		for column, value := range key {
+			if err := ValidateIdentifier("列名", column); err != nil {
+				return err
+			}
 
-func (dc *Client) RequestBatch(requests *[]InsertRequest) error {
-	requestMap := make(map[string][]map[string]any)
+			parts = append(parts, fmt.Sprintf("%s <=> ?", quoteIdentifier(column)))
+			values = append(values, value)
+		}
 
-	for _, req := range *requests {
-		if _, exists := requestMap[req.Table]; !exists {
-			requestMap[req.Table] = []map[string]any{}
+		if len(parts) == 0 {
+			continue
 		}
 
-		requestMap[req.Table] = append(requestMap[req.Table], req.Data)
+		conditions = append(conditions, fmt.Sprintf("(%s)", strings.Join(parts, " AND ")))
 	}
 
-	for table, dataMaps := range requestMap {
-		if dc.debug {
-			dc.dbLog.D("插入 %s 表，%d 条数据", table, len(dataMaps))
-		}
+	if len(conditions) == 0 {
+		return nil
+	}
 
-		err := dc.WriteToDbBatch(table, dataMaps)
-		if err != nil {
-			return fmt.Errorf("Failed to write to %s: %v", table, err)
-		}
+	//noinspection ALL
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s", quoteTable(dc.database, table), strings.Join(conditions, " OR "))
 
-		err = dc.clearInvalidData(table)
-		if err != nil {
-			dc.dbLog.W("clearInvalidData: %v", err)
-		}
+	if dc.debug && dc.sqlDebug {
+		dc.dbLog.D("DeleteFromDbBatch exec: %s, values: %v", stmt, values)
 	}
 
-	return nil
+	_, err := executor.Exec(stmt, values...)
+	return err
 }
 
 // utils:
@@ -363,11 +544,11 @@ func GetMysqlCreateTableSqlUnionKey(tableName string, data map[string]any, extra
 		isKey := false
 		if contains(unionKeys, key) {
 			isKey = true
-			primaryKeyParts = append(primaryKeyParts, fmt.Sprintf("`%s`", key))
+			primaryKeyParts = append(primaryKeyParts, quoteIdentifier(key))
 		}
 
 		columnType := getColumnType(value, isKey)
-		column := fmt.Sprintf("`%s` %s", key, columnType)
+		column := fmt.Sprintf("%s %s", quoteIdentifier(key), columnType)
 		columns = append(columns, column)
 	}
 
@@ -377,11 +558,11 @@ func GetMysqlCreateTableSqlUnionKey(tableName string, data map[string]any, extra
 			isKey := false
 			if contains(unionKeys, key) {
 				isKey = true
-				primaryKeyParts = append(primaryKeyParts, fmt.Sprintf("`%s`", key))
+				primaryKeyParts = append(primaryKeyParts, quoteIdentifier(key))
 			}
 
 			columnType := getColumnType(value, isKey)
-			column := fmt.Sprintf("`%s` %s", key, columnType)
+			column := fmt.Sprintf("%s %s", quoteIdentifier(key), columnType)
 			columns = append(columns, column)
 		}
 	}
@@ -395,10 +576,45 @@ func GetMysqlCreateTableSqlUnionKey(tableName string, data map[string]any, extra
 		primaryKeyStatement = fmt.Sprintf(", PRIMARY KEY (%s)", strings.Join(primaryKeyParts, ", "))
 	}
 
-	createTableStatement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` (%s%s);", tableName, strings.Join(columns, ", "), primaryKeyStatement)
+	createTableStatement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s%s);", quoteIdentifier(tableName), strings.Join(columns, ", "), primaryKeyStatement)
 	return createTableStatement
 }
 
+type columnGroup struct {
+	columns []string
+	rows    []map[string]any
+}
+
+// columnSignature 返回行的有序列名及其拼接结果
+func columnSignature(row map[string]any) ([]string, string) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+	return columns, strings.Join(columns, ",")
+}
+
+// groupByColumns 将列集合相同的连续行分为一组，保持行的先后顺序
+func groupByColumns(data []map[string]any) []*columnGroup {
+	var groups []*columnGroup
+	var current *columnGroup
+	currentSignature := ""
+	for _, row := range data {
+		columns, signature := columnSignature(row)
+		if current == nil || signature != currentSignature {
+			current = &columnGroup{columns: columns}
+			currentSignature = signature
+			groups = append(groups, current)
+		}
+
+		current.rows = append(current.rows, row)
+	}
+
+	return groups
+}
+
 // Helper function to check if a slice contains a particular element
 func contains(slice []string, element string) bool {
 	for _, v := range slice {
@@ -442,7 +658,7 @@ func GenerateCreateTableSQL(msg *InsertMessage) string {
 
 	for key, value := range msg.Data {
 		columnType := getColumnType1(value)
-		column := fmt.Sprintf("`%s` %s", key, columnType)
+		column := fmt.Sprintf("%s %s", quoteIdentifier(key), columnType)
 		columns = append(columns, column)
 	}
 
@@ -452,8 +668,8 @@ func GenerateCreateTableSQL(msg *InsertMessage) string {
 
 	// 生成建表语句
 	createTableSQL := fmt.Sprintf(
-		"CREATE TABLE IF NOT EXISTS `%s` (%s);",
-		msg.TableName, strings.Join(columns, ", "))
+		"CREATE TABLE IF NOT EXISTS %s (%s);",
+		quoteIdentifier(msg.TableName), strings.Join(columns, ", "))
 
 	return createTableSQL
 }
@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"venu-data/config"
+)
+
+const customTlsPrefix = "venus-data-"
+
+// tlsNames 已注册的自定义 TLS 配置，按模式、CA 和服务端名称区分，不同实例可以使用不同的 CA
+var tlsNames = make(map[config.MysqlTlsConfig]string)
+var tlsLock = sync.Mutex{}
+
+// registerTls 为配置了 CA 的 TLS 参数注册自定义配置并返回名称，相同参数只注册一次
+func registerTls(conf config.MysqlTlsConfig) (string, error) {
+	tlsLock.Lock()
+	defer tlsLock.Unlock()
+
+	if name, ok := tlsNames[conf]; ok {
+		return name, nil
+	}
+
+	pem, err := os.ReadFile(conf.CaFile)
+	if err != nil {
+		return "", fmt.Errorf("读取 CA 文件失败：%v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return "", fmt.Errorf("CA 文件中没有有效证书：%s", conf.CaFile)
+	}
+
+	name := fmt.Sprintf("%s%d", customTlsPrefix, len(tlsNames)+1)
+	err = mysqlDriver.RegisterTLSConfig(name, &tls.Config{
+		RootCAs:            pool,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.Tls == "skip-verify",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	tlsNames[conf] = name
+	return name, nil
+}
+
+// applyTls 按 tls 模式设置连接参数；设置 CA 时 false 仍不使用 TLS，preferred 用 CA 校验但服务端不支持时退回明文
+func applyTls(cfg *mysqlDriver.Config, conf config.MysqlTlsConfig) error {
+	if conf.CaFile == "" || conf.Tls == "false" {
+		cfg.TLSConfig = conf.Tls
+		return nil
+	}
+
+	name, err := registerTls(conf)
+	if err != nil {
+		return err
+	}
+
+	cfg.TLSConfig = name
+	cfg.AllowFallbackToPlaintext = conf.Tls == "preferred"
+	return nil
+}
+
+// buildDataSource 由地址、账号、实例的 TLS 参数和配置文件中的 mysql 块生成 DSN，账号中的特殊字符由驱动处理
+func buildDataSource(user string, pwd string, host string, port string, database string, tlsConf config.MysqlTlsConfig) (string, error) {
+	dsn := config.GetMysqlDsnConfig()
+
+	cfg := mysqlDriver.NewConfig()
+	cfg.User = user
+	cfg.Passwd = pwd
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, port)
+	cfg.DBName = database
+	cfg.ParseTime = dsn.ParseTime
+	cfg.Collation = dsn.Collation
+	cfg.Timeout = time.Duration(dsn.Timeout) * time.Second
+	cfg.ReadTimeout = time.Duration(dsn.ReadTimeout) * time.Second
+	cfg.WriteTimeout = time.Duration(dsn.WriteTimeout) * time.Second
+
+	if dsn.Loc != "" {
+		loc, err := time.LoadLocation(dsn.Loc)
+		if err != nil {
+			return "", fmt.Errorf("mysql loc 配置有误：%v", err)
+		}
+
+		cfg.Loc = loc
+	}
+
+	if err := applyTls(cfg, tlsConf); err != nil {
+		return "", err
+	}
+
+	params := make(map[string]string)
+	if dsn.Charset != "" {
+		params["charset"] = dsn.Charset
+	}
+
+	for k, v := range dsn.Params {
+		params[k] = v
+	}
+
+	if len(params) > 0 {
+		cfg.Params = params
+	}
+
+	// 经 FormatDSN 再解析一遍，提前发现无效的 TLS 名称等配置
+	source := cfg.FormatDSN()
+	if _, err := mysqlDriver.ParseDSN(source); err != nil {
+		return "", fmt.Errorf("mysql 连接参数有误：%v", err)
+	}
+
+	return source, nil
+}
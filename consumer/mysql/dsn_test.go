@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"venu-data/config"
+)
+
+// writeTestCa 生成自签名 CA 并写入临时文件
+func writeTestCa(t *testing.T, name string) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), name+".pem")
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func parseTestDsn(t *testing.T, tlsConf config.MysqlTlsConfig) *mysqlDriver.Config {
+	t.Helper()
+
+	source, err := buildDataSource("u", "p", "127.0.0.1", "3306", "test", tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := mysqlDriver.ParseDSN(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func TestBuildDataSourceTlsMode(t *testing.T) {
+	loadTestConfig(t, nil)
+	ca := writeTestCa(t, "ca")
+
+	tests := []struct {
+		name     string
+		tls      config.MysqlTlsConfig
+		enabled  bool
+		verify   bool
+		fallback bool
+	}{
+		{"无配置", config.MysqlTlsConfig{}, false, false, false},
+		{"CA 默认校验", config.MysqlTlsConfig{CaFile: ca}, true, true, false},
+		{"CA true", config.MysqlTlsConfig{Tls: "true", CaFile: ca}, true, true, false},
+		{"CA false", config.MysqlTlsConfig{Tls: "false", CaFile: ca}, false, false, false},
+		{"CA preferred", config.MysqlTlsConfig{Tls: "preferred", CaFile: ca}, true, true, true},
+		{"CA skip-verify", config.MysqlTlsConfig{Tls: "skip-verify", CaFile: ca}, true, false, false},
+		{"无 CA preferred", config.MysqlTlsConfig{Tls: "preferred"}, true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := parseTestDsn(t, tt.tls)
+			if (cfg.TLS != nil) != tt.enabled {
+				t.Fatalf("TLS 启用：%v，期望：%v", cfg.TLS != nil, tt.enabled)
+			}
+
+			if cfg.AllowFallbackToPlaintext != tt.fallback {
+				t.Errorf("退回明文：%v，期望：%v", cfg.AllowFallbackToPlaintext, tt.fallback)
+			}
+
+			if !tt.enabled {
+				return
+			}
+
+			if verify := !cfg.TLS.InsecureSkipVerify; verify != tt.verify {
+				t.Errorf("校验证书：%v，期望：%v", verify, tt.verify)
+			}
+
+			if tt.tls.CaFile != "" && cfg.TLS.RootCAs == nil {
+				t.Error("未使用配置的 CA")
+			}
+		})
+	}
+}
+
+func TestBuildDataSourceTlsPerCa(t *testing.T) {
+	loadTestConfig(t, nil)
+	first := config.MysqlTlsConfig{Tls: "true", CaFile: writeTestCa(t, "first")}
+	second := config.MysqlTlsConfig{Tls: "true", CaFile: writeTestCa(t, "second")}
+
+	firstName := parseTestDsn(t, first).TLSConfig
+	secondName := parseTestDsn(t, second).TLSConfig
+	if firstName == secondName {
+		t.Fatalf("不同 CA 使用了同一个 TLS 配置：%s", firstName)
+	}
+
+	if again := parseTestDsn(t, first).TLSConfig; again != firstName {
+		t.Errorf("相同 CA 重复注册：%s，%s", firstName, again)
+	}
+}
@@ -0,0 +1,290 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const (
+	defaultHealthCheckInterval = 10
+	defaultReconnectBackoffMax = 60
+	minReconnectBackoff        = time.Second
+)
+
+// probeTimeout 探测一个地址的总时长，包括建立连接
+var probeTimeout = 5 * time.Second
+
+// failoverErrorNumbers 表示连接已断开或实例只读的错误码，其余 MySQL 错误与主库状态无关
+var failoverErrorNumbers = map[uint16]bool{
+	1053: true, // 服务端正在关闭
+	1290: true, // read_only
+	1792: true, // 只读事务
+	1836: true, // 只读模式
+	1927: true, // 连接被终止
+	2006: true, // 服务端已断开
+	2013: true, // 查询中连接丢失
+}
+
+var errNoWritableHost = errors.New("没有可写的 MySQL 地址")
+
+// hostGroup 一个实例的候选地址，按顺序探测，写入 read_only=0 的地址。
+// 同一组地址的所有 Client 共用，主库变化时 generation 加一，Client 据此重连。
+type hostGroup struct {
+	addresses []string
+	user      string
+	pwd       string
+	tls       config.MysqlTlsConfig
+
+	lock       sync.Mutex
+	current    string
+	generation uint64
+	failures   int
+	retryAt    time.Time
+	// probing 非空时已有探测在进行，关闭后其他调用方重新读取结果
+	probing chan struct{}
+	log     *log.Log
+}
+
+var hostGroups = make(map[string]*hostGroup)
+var hostGroupLock = sync.Mutex{}
+
+func obtainHostGroup(addresses []string, user string, pwd string, tls config.MysqlTlsConfig) *hostGroup {
+	key := fmt.Sprintf("%s@%s/%v", user, strings.Join(addresses, ","), tls)
+
+	hostGroupLock.Lock()
+	defer hostGroupLock.Unlock()
+
+	group, ok := hostGroups[key]
+	if !ok {
+		group = &hostGroup{addresses: addresses, user: user, pwd: pwd, tls: tls, log: log.NewLog("MHG")}
+		hostGroups[key] = group
+		if len(addresses) > 1 {
+			go group.healthCheck()
+		}
+	}
+
+	return group
+}
+
+// primary 返回当前可写的地址，未知时依次探测；全部失败后按指数退避，退避期间直接返回错误。
+// 探测不持有锁，同一时间只有一个调用方探测，其余调用方等待探测结束
+func (g *hostGroup) primary() (string, uint64, error) {
+	g.lock.Lock()
+	for g.probing != nil {
+		probing := g.probing
+		g.lock.Unlock()
+		<-probing
+		g.lock.Lock()
+	}
+
+	if g.current != "" {
+		defer g.lock.Unlock()
+		return g.current, g.generation, nil
+	}
+
+	if time.Now().Before(g.retryAt) {
+		defer g.lock.Unlock()
+		return "", g.generation, errNoWritableHost
+	}
+
+	probing := make(chan struct{})
+	g.probing = probing
+	g.lock.Unlock()
+
+	address := g.probe()
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.probing = nil
+	close(probing)
+
+	if address == "" {
+		g.failures++
+		g.retryAt = time.Now().Add(reconnectBackoff(g.failures))
+		return "", g.generation, errNoWritableHost
+	}
+
+	g.current = address
+	g.generation++
+	g.failures = 0
+	g.retryAt = time.Time{}
+	if len(g.addresses) > 1 {
+		g.log.I("MySQL 主库：%s", address)
+	}
+
+	return g.current, g.generation, nil
+}
+
+// probe 依次探测各地址，返回第一个可写的地址，没有时返回空字符串
+func (g *hostGroup) probe() string {
+	for _, address := range g.addresses {
+		readOnly, err := probeHost(address, g.user, g.pwd, g.tls)
+		if err != nil {
+			g.log.W("探测 %s 失败：%v", address, err)
+			metrics.Add("mysql_probe_failures", 1)
+			continue
+		}
+
+		if !readOnly {
+			return address
+		}
+	}
+
+	return ""
+}
+
+// invalidate 地址出错或变为只读时调用，下次 primary 重新探测
+func (g *hostGroup) invalidate(address string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.current == "" || g.current != address {
+		return
+	}
+
+	g.current = ""
+	if len(g.addresses) > 1 {
+		g.log.W("MySQL 主库 %s 不可用，切换地址", address)
+		metrics.Add("mysql_failovers", 1)
+	}
+}
+
+func (g *hostGroup) currentGeneration() uint64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.generation
+}
+
+// healthCheck 定期检查当前主库，不可写时立即切换，不必等到写入失败
+func (g *hostGroup) healthCheck() {
+	interval := config.GetBaseConfig().MysqlHealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.lock.Lock()
+		current := g.current
+		g.lock.Unlock()
+
+		if current == "" {
+			continue
+		}
+
+		readOnly, err := probeHost(current, g.user, g.pwd, g.tls)
+		if err != nil || readOnly {
+			g.invalidate(current)
+			_, _, _ = g.primary()
+		}
+	}
+}
+
+func reconnectBackoff(failures int) time.Duration {
+	maxBackoff := time.Duration(config.GetBaseConfig().MysqlReconnectBackoffMax) * time.Second
+	if maxBackoff <= 0 {
+		maxBackoff = defaultReconnectBackoffMax * time.Second
+	}
+
+	backoff := minReconnectBackoff
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxBackoff)
+}
+
+// probeHost 查询地址的 read_only 状态，连接和查询共用 probeTimeout
+func probeHost(address string, user string, pwd string, tls config.MysqlTlsConfig) (bool, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false, err
+	}
+
+	source, err := buildDataSource(user, pwd, host, port, "", tls)
+	if err != nil {
+		return false, err
+	}
+
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		_ = db.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	var readOnly int
+	err = db.QueryRowContext(ctx, "SELECT @@global.read_only").Scan(&readOnly)
+	if err != nil {
+		return false, fmt.Errorf("查询 read_only 失败：%v", err)
+	}
+
+	return readOnly != 0, nil
+}
+
+// needsFailover 只有连接断开、网络错误和实例只读才可能意味着主库已切换，
+// 连接预算、配置、表结构和 TLS 校验等错误重连也无法恢复
+func needsFailover(err error) bool {
+	var mysqlErr *mysqlDriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return failoverErrorNumbers[mysqlErr.Number]
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqlDriver.ErrInvalidConn) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// connectPrimary 后台任务使用的单连接，连接实例当前的主库，主库切换后改用新地址；dbs 按地址缓存连接
+func connectPrimary(dbs map[string]*sql.DB, cfg config.MysqlDbConfig) (*sql.DB, error) {
+	address, _, err := obtainHostGroup(cfg.Addresses(), cfg.User, cfg.Pwd, cfg.Tls).primary()
+	if err != nil {
+		return nil, err
+	}
+
+	if db, ok := dbs[address]; ok {
+		return db, nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := buildDataSource(cfg.User, cfg.Pwd, host, port, "", cfg.Tls)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+	dbs[address] = db
+	return db, nil
+}
@@ -0,0 +1,111 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNeedsFailover(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"连接失效", driver.ErrBadConn, true},
+		{"驱动连接失效", fmt.Errorf("写入失败：%w", mysqlDriver.ErrInvalidConn), true},
+		{"网络错误", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"服务端断开", &mysqlDriver.MySQLError{Number: 2006}, true},
+		{"连接丢失", &mysqlDriver.MySQLError{Number: 2013}, true},
+		{"只读", &mysqlDriver.MySQLError{Number: 1290}, true},
+		{"锁等待", &mysqlDriver.MySQLError{Number: 1205}, false},
+		{"表不存在", &missingTableError{table: "t", err: &mysqlDriver.MySQLError{Number: 1146}}, false},
+		{"连接预算", errConnBudget, false},
+		{"批量导入模式", fmt.Errorf("不支持的批量导入模式：%s", "upsert"), false},
+		{"TLS 校验", errors.New("x509: certificate signed by unknown authority"), false},
+	}
+
+	for _, tt := range tests {
+		if got := needsFailover(tt.err); got != tt.want {
+			t.Errorf("%s：%v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestPrimaryProbesWithoutLock 探测一个不响应的地址时，其他调用方不应被锁阻塞，探测按 probeTimeout 结束
+func TestPrimaryProbesWithoutLock(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	// 接受连接后不发送握手包
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				for _, c := range conns {
+					_ = c.Close()
+				}
+
+				return
+			}
+
+			conns = append(conns, conn)
+		}
+	}()
+
+	timeout := probeTimeout
+	probeTimeout = 300 * time.Millisecond
+	defer func() {
+		probeTimeout = timeout
+	}()
+
+	group := &hostGroup{addresses: []string{listener.Addr().String()}, user: "u", pwd: "p", log: log.NewLog("MHG")}
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, _, err := group.primary()
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	checked := make(chan struct{})
+	go func() {
+		group.currentGeneration()
+		group.invalidate("other:3306")
+		close(checked)
+	}()
+
+	select {
+	case <-checked:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("探测期间持有锁")
+	}
+
+	select {
+	case err = <-done:
+		if !errors.Is(err, errNoWritableHost) {
+			t.Errorf("探测结果：%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("探测没有超时")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("探测耗时 %v", elapsed)
+	}
+}
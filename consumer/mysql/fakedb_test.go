@@ -0,0 +1,315 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"venu-data/config"
+)
+
+// fakeServer 测试用的 MySQL 替身，记录执行的语句，按 columns 校验 INSERT 的列并支持 ALTER TABLE ADD COLUMN
+type fakeServer struct {
+	lock    sync.Mutex
+	columns map[string]map[string]bool
+	execs   []string
+	open    int
+	maxOpen int
+	// delay 每条语句的执行耗时，用于制造并发
+	delay time.Duration
+	// failInsert 非空时所有 INSERT 返回该错误
+	failInsert error
+	// badValue 非空时参数中含有该值的 INSERT 返回数据错误，成功的 INSERT 参数记录在 inserted
+	badValue any
+	inserted []driver.Value
+}
+
+var fakeServers = make(map[string]*fakeServer)
+var fakeServersLock = sync.Mutex{}
+
+func init() {
+	sql.Register("fakemysql", fakeDriver{})
+}
+
+// newFakeDb 返回连接到新替身的 *sql.DB，tables 为已存在的表及其列
+func newFakeDb(t testing.TB, tables map[string][]string) (*sql.DB, *fakeServer) {
+	t.Helper()
+
+	server := &fakeServer{columns: make(map[string]map[string]bool)}
+	for table, columns := range tables {
+		server.columns[table] = make(map[string]bool)
+		for _, column := range columns {
+			server.columns[table][column] = true
+		}
+	}
+
+	fakeServersLock.Lock()
+	name := fmt.Sprintf("fake%d", len(fakeServers))
+	fakeServers[name] = server
+	fakeServersLock.Unlock()
+
+	db, err := sql.Open("fakemysql", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db, server
+}
+
+// newTestClient 使用替身连接的 Client
+func newTestClient(db *sql.DB) *Client {
+	return &Client{
+		dbClient: db,
+		database: "test",
+		columns:  make(map[string]map[string]bool),
+		dbLog:    log.NewLog("TEST"),
+	}
+}
+
+// newTestPool 处理器使用替身连接的连接池，测试结束时关闭
+func newTestPool(t testing.TB, db *sql.DB, size int) *Pool {
+	t.Helper()
+
+	mdp := &Pool{
+		dbHandlers: make([]*Handler, size),
+		dbInfo:     &DbInfo{name: "test"},
+		closing:    make(chan struct{}),
+		stop:       make(chan struct{}),
+		log:        log.NewLog("TEST"),
+	}
+
+	hosts := obtainHostGroup([]string{"fake:0"}, "test", "test", config.MysqlTlsConfig{})
+	for i := range mdp.dbHandlers {
+		client := newTestClient(db)
+		client.hosts = hosts
+		client.status.Store(dbStatusOk)
+
+		handler := &Handler{client: client, channel: make(chan InsertRequest, config.GetBaseConfig().MysqlPoolChannelSize)}
+		mdp.dbHandlers[i] = handler
+		mdp.stopped.Add(1)
+		go mdp.handleMysqlDbChan(handler)
+	}
+
+	t.Cleanup(mdp.close)
+	return mdp
+}
+
+// insertedRows INSERT 语句写入的总行数
+func (s *fakeServer) insertedRows() int {
+	rows := 0
+	for _, statement := range s.statements("INSERT INTO") {
+		rows += strings.Count(statement, "(?")
+	}
+
+	return rows
+}
+
+func (s *fakeServer) statements(prefix string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var matched []string
+	for _, statement := range s.execs {
+		if strings.HasPrefix(statement, prefix) {
+			matched = append(matched, statement)
+		}
+	}
+
+	return matched
+}
+
+var (
+	fakeTablePattern  = regexp.MustCompile("^(?:INSERT INTO|ALTER TABLE) `[^`]+`\\.`([^`]+)`")
+	fakeInsertPattern = regexp.MustCompile("^INSERT INTO \\S+ \\(([^)]*)\\)")
+	fakeAddPattern    = regexp.MustCompile("ADD COLUMN `([^`]+)`")
+	fakeKeyPattern    = regexp.MustCompile("PRIMARY KEY \\(([^)]*)\\)")
+	fakeRangePattern  = regexp.MustCompile("PARTITION BY RANGE \\(TO_DAYS\\((`[^`]+`)\\)\\)")
+)
+
+func (s *fakeServer) exec(query string) error {
+	time.Sleep(s.delay)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.execs = append(s.execs, query)
+
+	// 与 MySQL 一样，主键必须包含分区列
+	if partition := fakeRangePattern.FindStringSubmatch(query); partition != nil {
+		if key := fakeKeyPattern.FindStringSubmatch(query); key != nil && !strings.Contains(key[1], partition[1]) {
+			return &mysqlDriver.MySQLError{Number: errPartitionKey, Message: "A PRIMARY KEY must include all columns in the table's partitioning function"}
+		}
+	}
+
+	match := fakeTablePattern.FindStringSubmatch(query)
+	if match == nil {
+		return nil
+	}
+
+	columns, ok := s.columns[match[1]]
+	if !ok {
+		return &mysqlDriver.MySQLError{Number: errNoSuchTable, Message: "Table doesn't exist"}
+	}
+
+	if strings.HasPrefix(query, "ALTER TABLE") {
+		for _, add := range fakeAddPattern.FindAllStringSubmatch(query, -1) {
+			if columns[add[1]] {
+				return &mysqlDriver.MySQLError{Number: errDupFieldName, Message: "Duplicate column name"}
+			}
+
+			columns[add[1]] = true
+		}
+
+		return nil
+	}
+
+	if insert := fakeInsertPattern.FindStringSubmatch(query); insert != nil {
+		if s.failInsert != nil {
+			return s.failInsert
+		}
+
+		for _, column := range strings.Split(insert[1], ", ") {
+			if !columns[strings.Trim(column, "`")] {
+				return &mysqlDriver.MySQLError{Number: errBadField, Message: "Unknown column " + column}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeServer) query(query string, args []driver.Value) (driver.Rows, error) {
+	time.Sleep(s.delay)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rows := &fakeRows{columns: []string{"column_name"}}
+	if strings.Contains(query, "information_schema.columns") && len(args) == 2 {
+		for column := range s.columns[fmt.Sprint(args[1])] {
+			rows.values = append(rows.values, []driver.Value{column})
+		}
+	}
+
+	return rows, nil
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeServersLock.Lock()
+	server := fakeServers[name]
+	fakeServersLock.Unlock()
+
+	server.lock.Lock()
+	server.open++
+	server.maxOpen = max(server.maxOpen, server.open)
+	server.lock.Unlock()
+
+	return &fakeConn{server: server}, nil
+}
+
+type fakeConn struct {
+	server *fakeServer
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.server.lock.Lock()
+	c.server.open--
+	c.server.lock.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	time.Sleep(c.server.delay)
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	server := s.conn.server
+	if err := server.exec(s.query); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(s.query, "INSERT INTO") {
+		return driver.RowsAffected(1), nil
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for _, arg := range args {
+		if server.badValue != nil && arg == server.badValue {
+			return nil, &mysqlDriver.MySQLError{Number: 1366, Message: fmt.Sprintf("Incorrect integer value: '%v'", arg)}
+		}
+	}
+
+	server.inserted = append(server.inserted, args...)
+	return driver.RowsAffected(int64(len(args))), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.server.query(s.query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -11,7 +11,6 @@ import (
 
 type ReaderConsumer struct {
 	log     *pretty_log.Log
-	pools   map[string]*Pool
 	topic   string
 	groupId string
 	id      string
@@ -20,7 +19,6 @@ type ReaderConsumer struct {
 func NewMysqlReaderConsumer(topicConf config.TopicConfig) *ReaderConsumer {
 	return &ReaderConsumer{
 		log:     pretty_log.NewLog("IIC"),
-		pools:   make(map[string]*Pool),
 		topic:   topicConf.Name,
 		groupId: topicConf.GroupID,
 		id:      topicConf.GroupID + "_" + uuid.New().String(),
@@ -43,17 +41,10 @@ func (mc *ReaderConsumer) Id() string {
 }
 
 func (mc *ReaderConsumer) handlePlus(msg *InsertMessage) {
-	dbName := msg.DbName
-	pool, ok := mc.pools[dbName]
-	if !ok {
-		cfg := config.Get().MysqlDb
-		poolSize := config.GetBaseConfig().MysqlPoolSize
-		pool = NewPool(poolSize, dbName, cfg.Host, cfg.Port, cfg.User, cfg.Pwd, false)
-		pool.init()
-		mc.pools[dbName] = pool
-	}
-	createSql := GenerateCreateTableSQL(msg)
-	err := pool.createTable(createSql)
+	pool := obtainPool(msg.DbName)
+	err := pool.ensureTable(msg.TableName, func() string {
+		return GenerateCreateTableSQL(msg)
+	})
 	if err != nil {
 		mc.log.E("创建数据库%s表%s失败: %v", msg.DbName, msg.TableName, err)
 	}
@@ -73,6 +64,11 @@ func (mc *ReaderConsumer) Consume(msg *base.DataMessage) error {
 		return fmt.Errorf("#InsertConsumer.Consume json 解析错误：%v", err)
 	}
 
+	err = validateInsertMessage(&miMsg)
+	if err != nil {
+		return fmt.Errorf("#ReaderConsumer.Consume 消息校验失败：%v", err)
+	}
+
 	mc.handlePlus(&miMsg)
 	return nil
 }
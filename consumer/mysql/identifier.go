@@ -0,0 +1,245 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+	"venu-data/config"
+)
+
+const (
+	defaultIdentifierPattern   = `^[A-Za-z0-9_]+$`
+	defaultIdentifierMaxLength = 64
+)
+
+// IdentifierError 库名、表名或列名不符合规则，属于数据错误，不应重试
+type IdentifierError struct {
+	Kind string
+	Name string
+	Msg  string
+}
+
+func (e *IdentifierError) Error() string {
+	return fmt.Sprintf("非法%s %q：%s", e.Kind, e.Name, e.Msg)
+}
+
+type identifierRules struct {
+	pattern   *regexp.Regexp
+	maxLength int
+}
+
+var (
+	rulesOnce sync.Once
+	rules     identifierRules
+)
+
+func getIdentifierRules() identifierRules {
+	rulesOnce.Do(func() {
+		pattern := defaultIdentifierPattern
+		maxLength := defaultIdentifierMaxLength
+		base := config.GetBaseConfig()
+		if base.MysqlIdentifierPattern != "" {
+			pattern = base.MysqlIdentifierPattern
+		}
+
+		if base.MysqlIdentifierMaxLength > 0 {
+			maxLength = base.MysqlIdentifierMaxLength
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			rejectLog.E("mysql_identifier_pattern 无效，使用默认规则：%v", err)
+			re = regexp.MustCompile(defaultIdentifierPattern)
+		}
+
+		rules = identifierRules{pattern: re, maxLength: maxLength}
+	})
+
+	return rules
+}
+
+// ValidateIdentifier 校验来自消息的标识符。
+// 无论规则如何配置，空串、超长、反引号和控制字符都会被拒绝。
+func ValidateIdentifier(kind string, name string) error {
+	r := getIdentifierRules()
+	if name == "" {
+		return &IdentifierError{Kind: kind, Name: name, Msg: "不能为空"}
+	}
+
+	// MySQL 的长度限制按字符计算
+	if utf8.RuneCountInString(name) > r.maxLength {
+		return &IdentifierError{Kind: kind, Name: name, Msg: fmt.Sprintf("长度超过 %d", r.maxLength)}
+	}
+
+	for _, c := range name {
+		if c == '`' || c < 0x20 || c == 0x7f {
+			return &IdentifierError{Kind: kind, Name: name, Msg: "包含非法字符"}
+		}
+	}
+
+	if strings.HasSuffix(name, " ") {
+		return &IdentifierError{Kind: kind, Name: name, Msg: "不能以空格结尾"}
+	}
+
+	if !r.pattern.MatchString(name) {
+		return &IdentifierError{Kind: kind, Name: name, Msg: fmt.Sprintf("不匹配 %s", r.pattern.String())}
+	}
+
+	return nil
+}
+
+// quoteIdentifier 用反引号包裹标识符，内部的反引号转义为两个
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteTable(db string, table string) string {
+	return quoteIdentifier(db) + "." + quoteIdentifier(table)
+}
+
+func quoteIdentifiers(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+
+	return quoted
+}
+
+// normalizeColumns 规整列名并校验，规整后重名的列视为错误
+func normalizeColumns(data map[string]any) (map[string]any, error) {
+	normalized := make(map[string]any, len(data))
+	for key, value := range data {
+		column := fixDbName(key)
+		if err := ValidateIdentifier("列名", column); err != nil {
+			return nil, err
+		}
+
+		if _, exists := normalized[column]; exists {
+			return nil, &IdentifierError{Kind: "列名", Name: key, Msg: fmt.Sprintf("与其他列规整后重名 %s", column)}
+		}
+
+		normalized[column] = value
+	}
+
+	return normalized, nil
+}
+
+// validateInsertMessage 校验库名、表名并规整数据列名
+func validateInsertMessage(msg *InsertMessage) error {
+	if err := ValidateIdentifier("库名", msg.DbName); err != nil {
+		return err
+	}
+
+	if err := ValidateIdentifier("表名", msg.TableName); err != nil {
+		return err
+	}
+
+	data, err := normalizeColumns(msg.Data)
+	if err != nil {
+		return err
+	}
+
+	msg.Data = data
+	return nil
+}
+
+func validateColumns(columns []string) error {
+	for _, column := range columns {
+		if err := ValidateIdentifier("列名", column); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var createTablePrefix = regexp.MustCompile(
+	"(?i)^\\s*CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?(?:(`[^`]+`|\\w+)\\s*\\.\\s*)?(`[^`]+`|\\w+)\\s*\\(")
+
+var selectKeyword = regexp.MustCompile(`(?i)\bSELECT\b`)
+
+// validateCreateTableSql 校验建表消息中的原始语句：只能是一条 CREATE TABLE，库名、表名与消息一致，
+// 不能包含注释或 CREATE TABLE ... SELECT
+func validateCreateTableSql(db string, table string, statement string) error {
+	invalid := func(msg string) error {
+		return &IdentifierError{Kind: "建表语句", Name: table, Msg: msg}
+	}
+
+	match := createTablePrefix.FindStringSubmatch(statement)
+	if match == nil {
+		return invalid("只允许 CREATE TABLE 语句")
+	}
+
+	if strings.Trim(match[2], "`") != table || (match[1] != "" && strings.Trim(match[1], "`") != db) {
+		return invalid("库名或表名与消息不一致")
+	}
+
+	stripped, ok := stripQuoted(statement)
+	if !ok {
+		return invalid("引号不匹配")
+	}
+
+	if strings.Contains(stripped, "--") || strings.Contains(stripped, "#") || strings.Contains(stripped, "/*") {
+		return invalid("不能包含注释")
+	}
+
+	if i := strings.Index(stripped, ";"); i >= 0 && strings.TrimSpace(stripped[i+1:]) != "" {
+		return invalid("只允许一条语句")
+	}
+
+	if selectKeyword.MatchString(stripped) {
+		return invalid("不能包含 SELECT")
+	}
+
+	depth := 0
+	for _, c := range stripped {
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+		}
+
+		if depth < 0 {
+			break
+		}
+	}
+
+	if depth != 0 {
+		return invalid("括号不匹配")
+	}
+
+	return nil
+}
+
+// stripQuoted 将引号和反引号内的内容替换为空格，引号未闭合时返回 false
+func stripQuoted(statement string) (string, bool) {
+	var sb strings.Builder
+	var quote rune
+	escaped := false
+	for _, c := range statement {
+		switch {
+		case quote == 0:
+			if c == '\'' || c == '"' || c == '`' {
+				quote = c
+			}
+
+			sb.WriteRune(c)
+		case escaped:
+			escaped = false
+			sb.WriteByte(' ')
+		case c == '\\' && quote != '`':
+			escaped = true
+			sb.WriteByte(' ')
+		case c == quote:
+			quote = 0
+			sb.WriteRune(c)
+		default:
+			sb.WriteByte(' ')
+		}
+	}
+
+	return sb.String(), quote == 0
+}
@@ -0,0 +1,147 @@
+package mysql
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestValidateIdentifier(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"普通", "switch_port", true},
+		{"数字开头", "2024_data", true},
+		{"最大长度", strings.Repeat("a", 64), true},
+		{"空", "", false},
+		{"超长", strings.Repeat("a", 65), false},
+		{"反引号", "a`b", false},
+		{"反引号注入", "t` (id int); DROP TABLE users; --", false},
+		{"分号", "t;drop", false},
+		{"空格", "a b", false},
+		{"结尾空格", "ab ", false},
+		{"点号", "db.table", false},
+		{"换行", "a\nb", false},
+		{"NUL", "a\x00b", false},
+		{"DEL", "a\x7fb", false},
+		{"引号", "a'b", false},
+		{"注释", "a/*b*/", false},
+		{"中文", "表名", false},
+		{"全角反引号", "a｀b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIdentifier("表名", tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ValidateIdentifier(%q) = %v，期望合法：%v", tt.input, err, tt.valid)
+			}
+
+			var identifierErr *IdentifierError
+			if err != nil && !errors.As(err, &identifierErr) {
+				t.Fatalf("错误类型应为 IdentifierError：%T", err)
+			}
+		})
+	}
+}
+
+func TestValidateIdentifierCountsCharacters(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	// 默认规则只允许 ASCII，放开字符集后单独检查长度
+	saved := getIdentifierRules().pattern
+	rules.pattern = regexp.MustCompile(".*")
+	defer func() {
+		rules.pattern = saved
+	}()
+
+	if err := ValidateIdentifier("表名", strings.Repeat("表", 64)); err != nil {
+		t.Fatalf("64 个字符应合法：%v", err)
+	}
+
+	if err := ValidateIdentifier("表名", strings.Repeat("表", 65)); err == nil {
+		t.Fatal("65 个字符应超长")
+	}
+}
+
+func TestNormalizeColumns(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	tests := []struct {
+		name  string
+		data  map[string]any
+		valid bool
+	}{
+		{"普通", map[string]any{"id": 1, "name": "a"}, true},
+		{"反引号", map[string]any{"id`); DROP TABLE t; --": 1}, false},
+		{"空列名", map[string]any{"": 1}, false},
+		{"控制字符", map[string]any{"a\tb": 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := normalizeColumns(tt.data)
+			if (err == nil) != tt.valid {
+				t.Fatalf("normalizeColumns(%v) = %v，期望合法：%v", tt.data, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"t", "`t`"},
+		{"a`b", "`a``b`"},
+		{"``", "``````"},
+	}
+
+	for _, tt := range tests {
+		if got := quoteIdentifier(tt.input); got != tt.want {
+			t.Errorf("quoteIdentifier(%q) = %s，期望 %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCreateTableSql(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		valid     bool
+	}{
+		{"普通", "CREATE TABLE IF NOT EXISTS `port` (`id` BIGINT, `name` VARCHAR(255), PRIMARY KEY (`id`)) ENGINE=InnoDB;", true},
+		{"带库名", "create table switch.port (id int)", true},
+		{"注释中的分号", "CREATE TABLE port (id int COMMENT 'a;b -- c')", true},
+		{"转义引号", "CREATE TABLE port (name varchar(20) DEFAULT 'it\\'s; ok')", true},
+		{"多条语句", "CREATE TABLE port (id int); DROP TABLE users", false},
+		{"其他表", "CREATE TABLE users (id int)", false},
+		{"其他库", "CREATE TABLE mysql.port (id int)", false},
+		{"删除", "DROP TABLE port", false},
+		{"SELECT", "CREATE TABLE port (id int) SELECT * FROM mysql.user", false},
+		{"AS SELECT", "CREATE TABLE port (id int) AS SELECT password FROM users", false},
+		{"行注释", "CREATE TABLE port (id int) -- x", false},
+		{"井号注释", "CREATE TABLE port (id int) # x", false},
+		{"块注释", "CREATE TABLE port (id int) /*!50000 DROP TABLE users */", false},
+		{"引号未闭合", "CREATE TABLE port (id int DEFAULT 'a)", false},
+		{"括号不匹配", "CREATE TABLE port (id int))", false},
+		{"LIKE", "CREATE TABLE port LIKE users", false},
+		{"临时表", "CREATE TEMPORARY TABLE port (id int)", false},
+		{"空", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCreateTableSql("switch", "port", tt.statement)
+			if (err == nil) != tt.valid {
+				t.Fatalf("validateCreateTableSql(%q) = %v，期望合法：%v", tt.statement, err, tt.valid)
+			}
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/google/uuid"
 	prettyLog "github.com/my-dev-lib/pretty-log-go"
 	"sync"
-	"venu-data/config"
 	"venu-data/consumer/base"
 )
 
@@ -15,7 +14,6 @@ const (
 	topicCreateTable        = "mysql_create_table_switch"
 	topicInsertGroupId      = "mysql_insert_switch_group_0"
 	topicCreateTableGroupId = "mysql_create_table_switch_group_0"
-	poolSize                = 80
 )
 
 var (
@@ -30,13 +28,8 @@ type CreateTableMessage struct {
 }
 
 type CreateConsumer struct {
-	log   *prettyLog.Log
-	pools map[string]*Pool
-	id    string
-}
-
-func (cc *CreateConsumer) init() {
-	cc.pools = make(map[string]*Pool)
+	log *prettyLog.Log
+	id  string
 }
 
 func (cc *CreateConsumer) Topic() string {
@@ -52,14 +45,7 @@ func (cc *CreateConsumer) Id() string {
 }
 
 func (cc *CreateConsumer) handle(msg *CreateTableMessage) {
-	dbName := msg.DbName
-	pool, ok := cc.pools[dbName]
-	if !ok {
-		cfg := config.Get().MysqlDb
-		pool = NewPool(poolSize, dbName, cfg.Host, cfg.Port, cfg.User, cfg.Pwd, false)
-		cc.pools[dbName] = pool
-	}
-
+	pool := obtainPool(msg.DbName)
 	err := pool.createTable(msg.Sql)
 	cc.log.D("创建表成功 %s", msg.TableName)
 	if err != nil {
@@ -80,6 +66,19 @@ func (cc *CreateConsumer) Consume(msg *base.DataMessage) error {
 		return fmt.Errorf("#CreateConsumer.Consume json 解析错误：%v", err)
 	}
 
+	if err = ValidateIdentifier("库名", ctMsg.DbName); err != nil {
+		return fmt.Errorf("#CreateConsumer.Consume 消息校验失败：%v", err)
+	}
+
+	if err = ValidateIdentifier("表名", ctMsg.TableName); err != nil {
+		return fmt.Errorf("#CreateConsumer.Consume 消息校验失败：%v", err)
+	}
+
+	// sql 来自消息，只允许建该表
+	if err = validateCreateTableSql(ctMsg.DbName, ctMsg.TableName, ctMsg.Sql); err != nil {
+		return fmt.Errorf("#CreateConsumer.Consume 消息校验失败：%v", err)
+	}
+
 	createTableLock.Lock()
 	_, ok := createTableOnceMap[ctMsg.TableName]
 	if ok {
@@ -95,9 +94,8 @@ func (cc *CreateConsumer) Consume(msg *base.DataMessage) error {
 
 func NewCreateConsumer() *CreateConsumer {
 	return &CreateConsumer{
-		log:   prettyLog.NewLog("MCTC"),
-		pools: make(map[string]*Pool),
-		id:    topicCreateTableGroupId + "_" + uuid.New().String(),
+		log: prettyLog.NewLog("MCTC"),
+		id:  topicCreateTableGroupId + "_" + uuid.New().String(),
 	}
 }
 
@@ -108,9 +106,8 @@ type InsertMessage struct {
 }
 
 type InsertConsumer struct {
-	pools map[string]*Pool
-	log   *prettyLog.Log
-	id    string
+	log *prettyLog.Log
+	id  string
 }
 
 func (ic *InsertConsumer) GroupId() string {
@@ -126,15 +123,7 @@ func (ic *InsertConsumer) Id() string {
 }
 
 func (ic *InsertConsumer) handle(msg *InsertMessage) {
-	dbName := msg.DbName
-	pool, ok := ic.pools[dbName]
-	if !ok {
-		cfg := config.Get().MysqlDb
-		pool = NewPool(1, dbName, cfg.Host, cfg.Port, cfg.User, cfg.Pwd, false)
-		pool.init()
-		ic.pools[dbName] = pool
-	}
-
+	pool := obtainPool(msg.DbName)
 	err := pool.writeToMysqlDb(msg.TableName, msg.Data)
 	if err != nil {
 		ic.log.W("写入数据库失败：%v", err)
@@ -150,14 +139,18 @@ func (ic *InsertConsumer) Consume1(msg *base.DataMessage) error {
 		return fmt.Errorf("#InsertConsumer.Consume json 解析错误：%v", err)
 	}
 
+	err = validateInsertMessage(&miMsg)
+	if err != nil {
+		return fmt.Errorf("#InsertConsumer.Consume 消息校验失败：%v", err)
+	}
+
 	ic.handle(&miMsg)
 	return nil
 }
 
 func NewInsertConsumer() *InsertConsumer {
 	return &InsertConsumer{
-		log:   prettyLog.NewLog("MIC"),
-		pools: make(map[string]*Pool),
+		log: prettyLog.NewLog("MIC"),
 		//id:    topicInsertGroupId + "_" + fmt.Sprintf("%d", time.Now().Nanosecond()),
 		id: topicInsertGroupId + "_" + uuid.New().String(),
 	}
@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// maxPlaceholders 单条预处理语句的占位符上限
+	maxPlaceholders = 65535
+	// defaultMaxAllowedPacket 读取不到服务端配置时使用 MySQL 默认值 4MB
+	defaultMaxAllowedPacket = 4 << 20
+	// packetHeadroom 为协议头和语句其余部分预留的字节数
+	packetHeadroom = 4 << 10
+	// placeholderBytes 每个占位符在语句文本及参数类型中占用的字节数
+	placeholderBytes = 5
+)
+
+// rowTooLargeError 单行数据超过 max_allowed_packet，无法写入
+type rowTooLargeError struct {
+	size  int
+	limit int
+}
+
+func (e *rowTooLargeError) Error() string {
+	return fmt.Sprintf("单行数据约 %d 字节，超过 max_allowed_packet 限制 %d", e.size, e.limit)
+}
+
+// loadMaxAllowedPacket 连接时读取服务端 max_allowed_packet
+func (dc *Client) loadMaxAllowedPacket() {
+	var maxPacket int
+	err := dc.dbClient.QueryRow("SELECT @@max_allowed_packet").Scan(&maxPacket)
+	if err != nil || maxPacket <= 0 {
+		dc.dbLog.W("读取 max_allowed_packet 失败，使用默认值：%v", err)
+		maxPacket = defaultMaxAllowedPacket
+	}
+
+	dc.maxPacket = maxPacket
+}
+
+// valueSize 估算参数值在报文中占用的字节数
+func valueSize(value any) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v) + 9
+	case []byte:
+		return len(v) + 9
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64:
+		return 8
+	case time.Time:
+		return 12
+	default:
+		return len(fmt.Sprint(v)) + 9
+	}
+}
+
+// splitByLimits 按占位符数量和估算的报文大小拆分行
+func (dc *Client) splitByLimits(columns []string, rows []map[string]any) ([][]map[string]any, error) {
+	maxRows := len(rows)
+	if len(columns) > 0 && maxPlaceholders/len(columns) < maxRows {
+		maxRows = maxPlaceholders / len(columns)
+	}
+
+	maxPacket := dc.maxPacket
+	if maxPacket <= 0 {
+		maxPacket = defaultMaxAllowedPacket
+	}
+
+	limit := maxPacket - packetHeadroom
+
+	var chunks [][]map[string]any
+	start := 0
+	size := 0
+	for i, row := range rows {
+		rowSize := len(columns) * placeholderBytes
+		for _, column := range columns {
+			rowSize += valueSize(row[column])
+		}
+
+		if rowSize > limit {
+			return nil, &rowTooLargeError{size: rowSize, limit: limit}
+		}
+
+		if i > start && (i-start >= maxRows || size+rowSize > limit) {
+			chunks = append(chunks, rows[start:i])
+			start = i
+			size = 0
+		}
+
+		size += rowSize
+	}
+
+	if start < len(rows) {
+		chunks = append(chunks, rows[start:])
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,171 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRows 生成 n 行，每行的 columns 列均为 value
+func testRows(n int, columns []string, value any) []map[string]any {
+	rows := make([]map[string]any, n)
+	for i := range rows {
+		rows[i] = make(map[string]any, len(columns))
+		for _, column := range columns {
+			rows[i][column] = value
+		}
+	}
+
+	return rows
+}
+
+func testColumns(n int) []string {
+	columns := make([]string, n)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("c%d", i)
+	}
+
+	return columns
+}
+
+func chunkSizes(chunks [][]map[string]any) []int {
+	sizes := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		sizes[i] = len(chunk)
+	}
+
+	return sizes
+}
+
+func TestSplitByLimitsPlaceholders(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns int
+		rows    int
+		want    []int
+	}{
+		{name: "单列恰好达到上限", columns: 1, rows: maxPlaceholders, want: []int{maxPlaceholders}},
+		{name: "单列超出一行", columns: 1, rows: maxPlaceholders + 1, want: []int{maxPlaceholders, 1}},
+		{name: "三列恰好达到上限", columns: 3, rows: maxPlaceholders / 3, want: []int{maxPlaceholders / 3}},
+		{name: "三列超出一行", columns: 3, rows: maxPlaceholders/3 + 1, want: []int{maxPlaceholders / 3, 1}},
+		{name: "不能整除时向下取整", columns: 7, rows: maxPlaceholders/7*2 + 1, want: []int{maxPlaceholders / 7, maxPlaceholders / 7, 1}},
+		{name: "空数据", columns: 3, rows: 0, want: []int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// 报文上限足够大，只受占位符数量限制
+			client := &Client{maxPacket: 1 << 30}
+			columns := testColumns(test.columns)
+			chunks, err := client.splitByLimits(columns, testRows(test.rows, columns, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := chunkSizes(chunks); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("拆分结果 %v，期望 %v", got, test.want)
+			}
+
+			for _, chunk := range chunks {
+				if placeholders := len(chunk) * test.columns; placeholders > maxPlaceholders {
+					t.Fatalf("单条语句 %d 个占位符，超过上限", placeholders)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitByLimitsPacket(t *testing.T) {
+	// 单列字符串每行约 placeholderBytes + len + 9 字节，报文可用 300 字节
+	const limit = 300
+	rowBytes := func(size int) string {
+		return strings.Repeat("x", size-placeholderBytes-9)
+	}
+
+	tests := []struct {
+		name   string
+		values []string
+		want   []int
+		tooBig int
+	}{
+		{name: "恰好达到上限", values: []string{rowBytes(100), rowBytes(100), rowBytes(100)}, want: []int{3}},
+		{name: "超出一个字节", values: []string{rowBytes(100), rowBytes(100), rowBytes(101)}, want: []int{2, 1}},
+		{name: "多次拆分", values: []string{rowBytes(200), rowBytes(200), rowBytes(200), rowBytes(100)}, want: []int{1, 1, 2}},
+		{name: "单行恰好达到上限", values: []string{rowBytes(limit), rowBytes(limit)}, want: []int{1, 1}},
+		{name: "单行超出上限", values: []string{rowBytes(100), rowBytes(limit + 1)}, tooBig: limit + 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &Client{maxPacket: packetHeadroom + limit}
+			rows := make([]map[string]any, len(test.values))
+			for i, value := range test.values {
+				rows[i] = map[string]any{"v": value}
+			}
+
+			chunks, err := client.splitByLimits([]string{"v"}, rows)
+			if test.tooBig > 0 {
+				var tooLarge *rowTooLargeError
+				if !errors.As(err, &tooLarge) || tooLarge.size != test.tooBig || tooLarge.limit != limit {
+					t.Fatalf("应返回单行过大的错误：%v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := chunkSizes(chunks); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("拆分结果 %v，期望 %v", got, test.want)
+			}
+		})
+	}
+}
+
+// 未读取到 max_allowed_packet 时按默认值拆分
+func TestSplitByLimitsDefaultPacket(t *testing.T) {
+	limit := defaultMaxAllowedPacket - packetHeadroom
+	value := strings.Repeat("x", limit/2-placeholderBytes-9)
+
+	chunks, err := (&Client{}).splitByLimits([]string{"v"}, testRows(3, []string{"v"}, value))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := chunkSizes(chunks); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Fatalf("拆分结果 %v，期望 [2 1]", got)
+	}
+}
+
+// 超过报文上限的单行转入失败处理，其余行照常写入
+func TestRequestBatchRejectsRowLargerThanPacket(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id", "note"}})
+	client := newTestClient(db)
+	client.maxPacket = packetHeadroom + 300
+
+	requests := []InsertRequest{
+		{Table: "port", Data: map[string]any{"id": int64(1), "note": "a"}},
+		{Table: "port", Data: map[string]any{"id": int64(2), "note": strings.Repeat("x", 300)}},
+		{Table: "port", Data: map[string]any{"id": int64(3), "note": "c"}},
+	}
+
+	rejected, err := client.RequestBatch(&requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tooLarge *rowTooLargeError
+	if len(rejected) != 1 || rejected[0].Request.Data["id"] != int64(2) || !errors.As(rejected[0].Err, &tooLarge) {
+		t.Fatalf("应只拒绝过大的行：%v", rejected)
+	}
+
+	if rows := server.insertedRows(); rows != 2 {
+		t.Fatalf("应写入 2 行，实际 %d 行", rows)
+	}
+}
@@ -0,0 +1,444 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"path"
+	"strings"
+	"time"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const (
+	partitionModeRange  = "range"
+	partitionModeSuffix = "suffix"
+	partitionUnitMonth  = "month"
+
+	defaultPartitionInterval = 3600
+	defaultPartitionAhead    = 3
+	defaultPartitionColumn   = "create_at"
+	maxValuePartition        = "pmax"
+)
+
+// partitionRule 返回表匹配的第一条分区规则，未配置时返回 nil
+func partitionRule(db string, table string) *config.PartitionRule {
+	rules := config.GetMysqlPartitionConfig().Rules
+	for i := range rules {
+		rule := &rules[i]
+		dbMatched, _ := path.Match(rule.Db, db)
+		tableMatched, _ := path.Match(rule.Table, table)
+		if dbMatched && tableMatched {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func partitionColumn(rule *config.PartitionRule) string {
+	if rule.Column == "" {
+		return defaultPartitionColumn
+	}
+
+	return rule.Column
+}
+
+func partitionAhead(rule *config.PartitionRule) int {
+	if rule.Ahead <= 0 {
+		return defaultPartitionAhead
+	}
+
+	return rule.Ahead
+}
+
+func partitionLayout(rule *config.PartitionRule) string {
+	if rule.Unit == partitionUnitMonth {
+		return "200601"
+	}
+
+	return "20060102"
+}
+
+// periodStart 返回 t 所在分区的起始时间
+func periodStart(rule *config.PartitionRule, t time.Time) time.Time {
+	if rule.Unit == partitionUnitMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// periodAfter 返回 start 之后第 n 个分区的起始时间
+func periodAfter(rule *config.PartitionRule, start time.Time, n int) time.Time {
+	if rule.Unit == partitionUnitMonth {
+		return start.AddDate(0, n, 0)
+	}
+
+	return start.AddDate(0, 0, n)
+}
+
+// expired 分区的结束时间早于保留期限时可删除
+func expired(rule *config.PartitionRule, start time.Time, now time.Time) bool {
+	if rule.Ttl <= 0 {
+		return false
+	}
+
+	return !periodAfter(rule, start, 1).After(now.Add(-time.Duration(rule.Ttl) * time.Second))
+}
+
+func suffixTable(table string, rule *config.PartitionRule, start time.Time) string {
+	return table + "_" + start.Format(partitionLayout(rule))
+}
+
+// splitSuffixTable 解析 suffix 模式的分表名，返回原表名、规则和分表的起始时间
+func splitSuffixTable(db string, name string) (string, *config.PartitionRule, time.Time, bool) {
+	i := strings.LastIndex(name, "_")
+	if i <= 0 {
+		return "", nil, time.Time{}, false
+	}
+
+	base := name[:i]
+	rule := partitionRule(db, base)
+	if rule == nil || rule.Mode != partitionModeSuffix {
+		return "", nil, time.Time{}, false
+	}
+
+	start, err := time.ParseInLocation(partitionLayout(rule), name[i+1:], time.Local)
+	if err != nil {
+		return "", nil, time.Time{}, false
+	}
+
+	return base, rule, start, true
+}
+
+// isPartitionedTable 分区表的过期数据由分区管理删除，不参与按行清理；
+// range 规则的表因主键不含分区列而未分区时 partitioned 为 false，仍按行清理
+func isPartitionedTable(db string, table string, partitioned bool) bool {
+	if rule := partitionRule(db, table); rule != nil {
+		return rule.Mode == partitionModeSuffix || partitioned
+	}
+
+	_, _, _, ok := splitSuffixTable(db, table)
+	return ok
+}
+
+// rowTime 取行中分区列的时间，支持常见的时间字符串和秒或毫秒时间戳，缺失或无法解析时使用当前时间
+func rowTime(row map[string]any, column string) time.Time {
+	switch v := row[column].(type) {
+	case string:
+		for _, layout := range []string{time.DateTime, time.RFC3339Nano, time.DateOnly} {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t
+			}
+		}
+	case float64:
+		if v > 1e12 {
+			return time.UnixMilli(int64(v))
+		}
+
+		return time.Unix(int64(v), 0)
+	case int64:
+		if v > 1e12 {
+			return time.UnixMilli(v)
+		}
+
+		return time.Unix(v, 0)
+	case time.Time:
+		return v
+	}
+
+	return time.Now()
+}
+
+// rangePartition 分区 pYYYYMMDD 存放该时间段内的行
+func rangePartition(rule *config.PartitionRule, start time.Time) string {
+	return fmt.Sprintf("PARTITION p%s VALUES LESS THAN (TO_DAYS('%s'))",
+		start.Format(partitionLayout(rule)), periodAfter(rule, start, 1).Format(time.DateOnly))
+}
+
+// partitionClause range 模式下的 RANGE 分区子句，追加在建表语句之后；不修改主键，
+// 主键或唯一键不含分区列时 MySQL 拒绝建表，由 ensureTable 改为不分区
+func partitionClause(db string, table string) string {
+	rule := partitionRule(db, table)
+	if rule == nil || rule.Mode != partitionModeRange {
+		return ""
+	}
+
+	now := periodStart(rule, time.Now())
+	var partitions []string
+	for i := 0; i <= partitionAhead(rule); i++ {
+		partitions = append(partitions, rangePartition(rule, periodAfter(rule, now, i)))
+	}
+
+	partitions = append(partitions, "PARTITION "+maxValuePartition+" VALUES LESS THAN MAXVALUE")
+	return fmt.Sprintf("PARTITION BY RANGE (TO_DAYS(%s)) (%s)", quoteIdentifier(partitionColumn(rule)), strings.Join(partitions, ", "))
+}
+
+// partitionTable suffix 模式下返回行所属的分表，分表按原表结构创建；其余情况返回原表名
+func (mdp *Pool) partitionTable(table string, row map[string]any) string {
+	rule := partitionRule(mdp.dbInfo.name, table)
+	if rule == nil || rule.Mode != partitionModeSuffix {
+		return table
+	}
+
+	name := suffixTable(table, rule, periodStart(rule, rowTime(row, partitionColumn(rule))))
+	err := mdp.ensureTable(name, func() string {
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", quoteIdentifier(name), quoteIdentifier(table))
+	})
+	if err != nil {
+		mdp.log.E("创建分表 %s.%s 失败：%v", mdp.dbInfo.name, name, err)
+	}
+
+	return name
+}
+
+// PartitionManager 定期提前创建分区并删除过期分区，取代按行删除
+type PartitionManager struct {
+	conf config.PartitionConfig
+	dbs  map[string]*sql.DB
+	log  *log.Log
+}
+
+func NewPartitionManager(conf config.PartitionConfig) *PartitionManager {
+	if conf.Interval <= 0 {
+		conf.Interval = defaultPartitionInterval
+	}
+
+	return &PartitionManager{conf: conf, dbs: make(map[string]*sql.DB), log: log.NewLog("MPM")}
+}
+
+// StartPartitionManager 没有配置规则时不启动
+func StartPartitionManager() {
+	conf := config.GetMysqlPartitionConfig()
+	if len(conf.Rules) == 0 {
+		return
+	}
+
+	go NewPartitionManager(conf).Run()
+}
+
+func (pm *PartitionManager) Run() {
+	ticker := time.NewTicker(time.Duration(pm.conf.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		pm.RunOnce()
+		<-ticker.C
+	}
+}
+
+// RunOnce 依次维护每个 MySQL 实例上的分区表
+func (pm *PartitionManager) RunOnce() {
+	for endpoint, cfg := range config.Get().MysqlEndpoints {
+		db, err := connectPrimary(pm.dbs, cfg)
+		if err != nil {
+			pm.log.E("连接数据库 %s 失败：%v", endpoint, err)
+			continue
+		}
+
+		pm.runEndpoint(endpoint, db)
+	}
+
+	metrics.Add("mysql_partition_runs", 1)
+}
+
+// candidateTables 与 RetentionScheduler.candidateTables 相同，只维护本进程写入过的表和规则中明确列出（不含通配符）的表
+func (pm *PartitionManager) candidateTables(endpoint string) map[string]map[string]bool {
+	tables := managedTables(endpoint)
+	for _, rule := range pm.conf.Rules {
+		addExplicitTable(tables, endpoint, rule.Db, rule.Table)
+	}
+
+	return tables
+}
+
+// owned suffix 模式的分表随原表一起判断，重启后也能删除之前建的过期分表
+func owned(candidates map[string]map[string]bool, db string, table string) bool {
+	if base, _, _, ok := splitSuffixTable(db, table); ok {
+		return candidates[db][base]
+	}
+
+	return candidates[db][table]
+}
+
+func (pm *PartitionManager) runEndpoint(endpoint string, conn *sql.DB) {
+	candidates := pm.candidateTables(endpoint)
+	if len(candidates) == 0 {
+		return
+	}
+
+	var args []any
+	var placeholders []string
+	for db := range candidates {
+		args = append(args, db)
+		placeholders = append(placeholders, "?")
+	}
+
+	//noinspection ALL
+	rows, err := conn.Query("SELECT table_schema, table_name, IFNULL(create_options, '') FROM information_schema.tables "+
+		"WHERE table_type = 'BASE TABLE' "+
+		"AND table_schema IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		pm.log.E("查询 %s 表结构失败：%v", endpoint, err)
+		return
+	}
+
+	type table struct {
+		db          string
+		name        string
+		partitioned bool
+	}
+
+	var tables []table
+	for rows.Next() {
+		var t table
+		var options string
+		if err := rows.Scan(&t.db, &t.name, &options); err != nil {
+			pm.log.E("读取表结构失败：%v", err)
+			break
+		}
+
+		if !owned(candidates, t.db, t.name) {
+			continue
+		}
+
+		t.partitioned = strings.Contains(strings.ToLower(options), "partitioned")
+		tables = append(tables, t)
+	}
+
+	_ = rows.Close()
+
+	now := time.Now()
+	for _, t := range tables {
+		var err error
+		if _, rule, start, ok := splitSuffixTable(t.db, t.name); ok {
+			if expired(rule, start, now) {
+				err = pm.dropSuffixTable(conn, t.db, t.name)
+			}
+		} else if rule := partitionRule(t.db, t.name); rule != nil {
+			switch {
+			case rule.Mode == partitionModeSuffix:
+				err = pm.createSuffixTables(conn, t.db, t.name, rule, now)
+			case t.partitioned:
+				err = pm.maintainRange(conn, t.db, t.name, rule, now)
+			default:
+				pm.log.W("表 %s/%s.%s 未分区，跳过", endpoint, t.db, t.name)
+			}
+		}
+
+		if err != nil {
+			pm.log.W("维护分区 %s/%s.%s 失败：%v", endpoint, t.db, t.name, err)
+			metrics.Add("mysql_partition_errors", 1)
+		}
+	}
+}
+
+// createSuffixTables 按原表结构提前创建当前及之后 Ahead 个时间段的分表
+func (pm *PartitionManager) createSuffixTables(conn *sql.DB, db string, table string, rule *config.PartitionRule, now time.Time) error {
+	start := periodStart(rule, now)
+	for i := 0; i <= partitionAhead(rule); i++ {
+		name := suffixTable(table, rule, periodAfter(rule, start, i))
+		//noinspection ALL
+		_, err := conn.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", quoteTable(db, name), quoteTable(db, table)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pm *PartitionManager) dropSuffixTable(conn *sql.DB, db string, name string) error {
+	//noinspection ALL
+	_, err := conn.Exec("DROP TABLE IF EXISTS " + quoteTable(db, name))
+	if err != nil {
+		return err
+	}
+
+	pm.log.I("删除过期分表 %s.%s", db, name)
+	metrics.Add("mysql_partitions_dropped", 1)
+	return nil
+}
+
+// maintainRange 拆分 pmax 补齐之后 Ahead 个分区，并删除过期分区
+func (pm *PartitionManager) maintainRange(conn *sql.DB, db string, table string, rule *config.PartitionRule, now time.Time) error {
+	rows, err := conn.Query("SELECT partition_name FROM information_schema.partitions "+
+		"WHERE table_schema = ? AND table_name = ? AND partition_name IS NOT NULL", db, table)
+	if err != nil {
+		return err
+	}
+
+	var latest time.Time
+	var dropped []string
+	hasMax := false
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		if name == maxValuePartition {
+			hasMax = true
+			continue
+		}
+
+		start, err := time.ParseInLocation(partitionLayout(rule), strings.TrimPrefix(name, "p"), time.Local)
+		if err != nil {
+			continue
+		}
+
+		if start.After(latest) {
+			latest = start
+		}
+
+		if expired(rule, start, now) {
+			dropped = append(dropped, quoteIdentifier(name))
+		}
+	}
+
+	_ = rows.Close()
+
+	// 新分区只能追加在已有分区之后
+	var added []string
+	start := periodStart(rule, now)
+	for i := 0; i <= partitionAhead(rule); i++ {
+		period := periodAfter(rule, start, i)
+		if period.After(latest) {
+			added = append(added, rangePartition(rule, period))
+		}
+	}
+
+	if count := len(added); count > 0 {
+		var stmt string
+		if hasMax {
+			added = append(added, "PARTITION "+maxValuePartition+" VALUES LESS THAN MAXVALUE")
+			stmt = fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s)",
+				quoteTable(db, table), maxValuePartition, strings.Join(added, ", "))
+		} else {
+			stmt = fmt.Sprintf("ALTER TABLE %s ADD PARTITION (%s)", quoteTable(db, table), strings.Join(added, ", "))
+		}
+
+		//noinspection ALL
+		if _, err := conn.Exec(stmt); err != nil {
+			return err
+		}
+
+		metrics.Add("mysql_partitions_created", int64(count))
+	}
+
+	if len(dropped) > 0 {
+		//noinspection ALL
+		_, err := conn.Exec(fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s", quoteTable(db, table), strings.Join(dropped, ", ")))
+		if err != nil {
+			return err
+		}
+
+		pm.log.I("删除 %s.%s 的过期分区 %s", db, table, strings.Join(dropped, ", "))
+		metrics.Add("mysql_partitions_dropped", int64(len(dropped)))
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+	"venu-data/config"
+)
+
+func TestEnsureTablePartitionKeepsPrimaryKey(t *testing.T) {
+	loadTestConfig(t, map[string]any{
+		"mysql_partitions": map[string]any{
+			"rules": []map[string]any{{"db": "test", "table": "partition_*", "mode": "range", "unit": "day"}},
+		},
+	})
+
+	tests := []struct {
+		table       string
+		key         []string
+		creates     int
+		partitioned bool
+	}{
+		{"partition_upsert", []string{"id"}, 2, false},
+		{"partition_keyed", []string{"id", "create_at"}, 1, true},
+		{"partition_append", nil, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			db, server := newFakeDb(t, nil)
+			pool := newTestPool(t, db, 1)
+			ddl := "CREATE TABLE IF NOT EXISTS `" + tt.table + "` (`id` BIGINT, `create_at` DATETIME DEFAULT CURRENT_TIMESTAMP"
+			if len(tt.key) > 0 {
+				ddl += ", PRIMARY KEY (`" + strings.Join(tt.key, "`, `") + "`)"
+			}
+
+			ddl += ");"
+
+			if err := pool.ensureTable(tt.table, func() string { return ddl }); err != nil {
+				t.Fatal(err)
+			}
+
+			creates := server.statements("CREATE TABLE")
+			if len(creates) != tt.creates {
+				t.Fatalf("建表 %d 次，期望 %d 次：%v", len(creates), tt.creates, creates)
+			}
+
+			last := creates[len(creates)-1]
+			if partitioned := strings.Contains(last, "PARTITION BY RANGE"); partitioned != tt.partitioned {
+				t.Errorf("分区：%v，期望：%v：%s", partitioned, tt.partitioned, last)
+			}
+
+			// 主键保持建表语句中的定义，分区列不会被加入主键
+			for _, create := range creates {
+				key := fakeKeyPattern.FindStringSubmatch(create)
+				if len(tt.key) == 0 && key != nil || len(tt.key) > 0 && key[1] != "`"+strings.Join(tt.key, "`, `")+"`" {
+					t.Errorf("主键被修改：%s", create)
+				}
+			}
+		})
+	}
+}
+
+func TestIsPartitionedTable(t *testing.T) {
+	loadTestConfig(t, map[string]any{
+		"mysql_partitions": map[string]any{
+			"rules": []map[string]any{
+				{"db": "test", "table": "events", "mode": "range", "unit": "day"},
+				{"db": "test", "table": "logs", "mode": "suffix", "unit": "month"},
+			},
+		},
+	})
+
+	tests := []struct {
+		table       string
+		partitioned bool
+		want        bool
+	}{
+		{"events", true, true},
+		{"events", false, false},
+		{"logs", false, true},
+		{"logs_202610", false, true},
+		{"other", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := isPartitionedTable("test", tt.table, tt.partitioned); got != tt.want {
+			t.Errorf("%s（已分区 %v）：%v，期望 %v", tt.table, tt.partitioned, got, tt.want)
+		}
+	}
+}
+
+func TestPartitionCandidateTables(t *testing.T) {
+	loadTestConfig(t, map[string]any{
+		"mysql_partitions": map[string]any{
+			"rules": []map[string]any{
+				{"db": "audit", "table": "login_log", "mode": "range"},
+				{"db": "*", "table": "*", "mode": "suffix", "ttl": 86400},
+			},
+		},
+	})
+
+	schemaLock.Lock()
+	schemaCache[schemaKey(config.DefaultMysqlEndpoint, "switch", "port")] = &tableSchema{endpoint: config.DefaultMysqlEndpoint, db: "switch", table: "port", created: true}
+	schemaLock.Unlock()
+
+	defer func() {
+		schemaLock.Lock()
+		schemaCache = make(map[string]*tableSchema)
+		schemaLock.Unlock()
+	}()
+
+	pm := NewPartitionManager(config.GetMysqlPartitionConfig())
+	endpoint, _ := config.ResolveMysqlEndpoint("switch")
+	candidates := pm.candidateTables(endpoint)
+
+	tests := []struct {
+		db    string
+		table string
+		want  bool
+	}{
+		{"switch", "port", true},
+		{"switch", "port_20261016", true},
+		{"switch", "other", false},
+		{"switch", "other_20261016", false},
+		{"audit", "login_log", true},
+		{"mysql", "user", false},
+	}
+
+	for _, tt := range tests {
+		if got := owned(candidates, tt.db, tt.table); got != tt.want {
+			t.Errorf("%s.%s：%v，期望 %v", tt.db, tt.table, got, tt.want)
+		}
+	}
+}
@@ -2,19 +2,47 @@ package mysql
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	log "github.com/my-dev-lib/pretty-log-go"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
 	"time"
 	"venu-data/config"
+	"venu-data/internal/metrics"
 )
 
 const (
 	handleMaxBufferSize  = 10
 	writeMaxIntervalTime = 10 * time.Second
 	poolChannelSize      = 100
+	maxFlushBackoff      = 30 * time.Second
+
+	defaultFlushMaxRetries = 10
 )
 
+// minFlushBackoff 写入失败后第一次重试前的等待时间，之后逐次翻倍直到 maxFlushBackoff
+var minFlushBackoff = minReconnectBackoff
+
+// RejectHandler 处理无法写入的行，默认仅记录日志
+type RejectHandler func(db string, rejected RejectedRequest)
+
+var rejectHandler RejectHandler = logRejected
+var rejectLog = log.NewLog("MR")
+
+func SetRejectHandler(handler RejectHandler) {
+	if handler == nil {
+		handler = logRejected
+	}
+
+	rejectHandler = handler
+}
+
+func logRejected(db string, rejected RejectedRequest) {
+	rejectLog.E("丢弃无法写入的数据 %s.%s：%v, data: %v", db, rejected.Request.Table, rejected.Err, rejected.Request.Data)
+}
+
 type Handler struct {
 	client  *Client
 	channel chan InsertRequest
@@ -22,33 +50,49 @@ type Handler struct {
 
 type DbInfo struct {
 	name string
-	host string
-	port string
-	user string
-	pwd  string
+	// hosts 按优先级排列的地址，见 hostGroup
+	hosts []string
+	user  string
+	pwd   string
+	tls   config.MysqlTlsConfig
 }
 
+var errPoolClosed = errors.New("连接池已关闭")
+
 type Pool struct {
 	dbHandlers    []*Handler
-	currentIndex  int
+	currentIndex  atomic.Uint32
 	lastWriteTime time.Time
 	handlerLock   sync.Mutex
 	dbInfo        *DbInfo
+	endpoint      string
+	shard         bool
 	debug         bool
 	log           *log.Log
+
+	lastUsed  atomic.Int64
+	closed    bool
+	closeLock sync.RWMutex
+	closeOnce sync.Once
+	// closing 关闭时最先关闭，唤醒阻塞在已满通道上的 send；stop 在不再有 send 之后关闭，通知处理器退出
+	closing chan struct{}
+	stop    chan struct{}
+	stopped sync.WaitGroup
 }
 
-func NewPool(poolSize uint32, db string, host string, port string, user string, pwd string, debug bool) *Pool {
+func NewPool(poolSize uint32, db string, hosts []string, user string, pwd string, tls config.MysqlTlsConfig, debug bool) *Pool {
 	mdp := &Pool{
 		dbHandlers: make([]*Handler, poolSize),
 		dbInfo: &DbInfo{
-			name: db,
-			host: host,
-			port: port,
-			user: user,
-			pwd:  pwd,
+			name:  db,
+			hosts: hosts,
+			user:  user,
+			pwd:   pwd,
+			tls:   tls,
 		},
-		debug: debug,
+		debug:   debug,
+		closing: make(chan struct{}),
+		stop:    make(chan struct{}),
 	}
 	mdp.log = log.NewLog("MP")
 
@@ -60,43 +104,85 @@ func NewPool(poolSize uint32, db string, host string, port string, user string,
 
 func (mdp *Pool) init() {
 	for i := 0; i < len(mdp.dbHandlers); i++ {
-		client := NewClient(mdp.dbInfo.name, mdp.dbInfo.host, mdp.dbInfo.port, mdp.dbInfo.user, mdp.dbInfo.pwd, mdp.debug)
+		client := NewClient(mdp.dbInfo.name, mdp.dbInfo.hosts, mdp.dbInfo.user, mdp.dbInfo.pwd, mdp.dbInfo.tls, mdp.debug)
 		element := &Handler{
 			client: client, channel: make(chan InsertRequest, config.GetBaseConfig().MysqlPoolChannelSize),
 		}
 
 		mdp.dbHandlers[i] = element
+		mdp.stopped.Add(1)
 		go mdp.handleMysqlDbChan(element)
 	}
 }
 
-func (mdp *Pool) obtainHandler() *Handler {
-	if mdp.currentIndex >= len(mdp.dbHandlers) {
-		mdp.currentIndex = 0
+func (mdp *Pool) touch() {
+	mdp.lastUsed.Store(time.Now().UnixNano())
+}
+
+func (mdp *Pool) lastUsedTime() time.Time {
+	return time.Unix(0, mdp.lastUsed.Load())
+}
+
+// close 停止接收新数据，各处理器写完缓冲区后释放连接。
+// 处理器在重试时不读取通道，阻塞的 send 由 closing 唤醒后才能取得写锁
+func (mdp *Pool) close() {
+	mdp.closeOnce.Do(func() {
+		close(mdp.closing)
+
+		mdp.closeLock.Lock()
+		mdp.closed = true
+		mdp.closeLock.Unlock()
+
+		close(mdp.stop)
+	})
+
+	mdp.stopped.Wait()
+}
+
+// send 投递请求，连接池关闭后返回 errPoolClosed。
+// 投递时持有读锁，close 取得写锁后通道中不会再有新请求，处理器退出前能全部写完
+func (mdp *Pool) send(handler *Handler, req InsertRequest) error {
+	mdp.closeLock.RLock()
+	defer mdp.closeLock.RUnlock()
+
+	if mdp.closed {
+		return errPoolClosed
+	}
+
+	select {
+	case handler.channel <- req:
+		return nil
+	case <-mdp.closing:
+		return errPoolClosed
 	}
+}
+
+func (mdp *Pool) obtainHandler() *Handler {
+	index := mdp.currentIndex.Add(1) - 1
+	return mdp.dbHandlers[index%uint32(len(mdp.dbHandlers))]
+}
 
-	handler := mdp.dbHandlers[mdp.currentIndex]
-	mdp.currentIndex = mdp.currentIndex + 1
+func (mdp *Pool) obtainHandlerByKey(routeKey string) *Handler {
+	if routeKey == "" {
+		return mdp.obtainHandler()
+	}
 
-	return handler
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(routeKey))
+	return mdp.dbHandlers[h.Sum32()%uint32(len(mdp.dbHandlers))]
 }
 
 func (mdp *Pool) FindIPv4(table string, hostName string) (string, error) {
-	// 获取一个数据库处理器
-	handler := mdp.obtainHandler()
 	// SQL 查询语句
-	sqlQuery := fmt.Sprintf("SELECT IP FROM %s WHERE name = ?", table)
-
-	// 初始化数据库连接
-	err := handler.client.Init()
-	if err != nil {
-		mdp.log.E("初始化客户端失败: %v", err)
-		return "", fmt.Errorf("初始化客户端失败: %v", err)
+	if err := ValidateIdentifier("表名", table); err != nil {
+		return "", err
 	}
 
-	// 查询数据库
+	sqlQuery := fmt.Sprintf("SELECT IP FROM %s WHERE name = ?", quoteIdentifier(table))
+
+	// 查询数据库，分片表按 name 定位分片
 	var ip string
-	err = handler.client.QueryRow(sqlQuery, hostName).Scan(&ip)
+	err := mdp.queryShards(table, map[string]any{"name": hostName}, sqlQuery, []any{hostName}, &ip)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			mdp.log.W("没有找到主机名对应的 IP: %s", hostName)
@@ -109,7 +195,35 @@ func (mdp *Pool) FindIPv4(table string, hostName string) (string, error) {
 	return ip, nil
 }
 
+// queryShards 在表所在的连接池上查询一行，分片表依次查询 shardReadPools 返回的分片，都没有数据时返回 sql.ErrNoRows
+func (mdp *Pool) queryShards(table string, row map[string]any, query string, args []any, dest ...any) error {
+	for _, pool := range mdp.shardReadPools(table, row) {
+		// 初始化数据库连接
+		handler := pool.obtainHandler()
+		err := handler.client.Init()
+		if err != nil {
+			pool.log.E("初始化客户端失败: %v", err)
+			return fmt.Errorf("初始化客户端失败: %v", err)
+		}
+
+		err = handler.client.QueryRow(query, args...).Scan(dest...)
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
 func (mdp *Pool) writeToMysqlDb(table string, data map[string]any) error {
+	if routed, err := mdp.routeShards(table, data, func(pool *Pool) error {
+		return pool.writeToMysqlDb(table, data)
+	}); routed {
+		return err
+	}
+
+	table = mdp.partitionTable(table, data)
+
 	copiedData := make(map[string]any)
 
 	for k, v := range data {
@@ -117,12 +231,54 @@ func (mdp *Pool) writeToMysqlDb(table string, data map[string]any) error {
 	}
 	//mdp.log.D("copedData:", copiedData)
 
-	handler := mdp.obtainHandler()
-	handler.channel <- InsertRequest{
+	return mdp.send(mdp.obtainHandler(), InsertRequest{
 		Table: table,
 		Data:  copiedData,
+	})
+}
+
+// deleteFromMysqlDb 按主键删除数据，routeKey 相同的请求交给同一个处理器以保证先后顺序；
+// locate 用于选择分片和分表，主键不含分片键或分区列时由调用方补上删除前的行
+func (mdp *Pool) deleteFromMysqlDb(table string, key map[string]any, locate map[string]any, routeKey string) error {
+	if routed, err := mdp.routeShards(table, locate, func(pool *Pool) error {
+		return pool.deleteFromMysqlDb(table, key, locate, routeKey)
+	}); routed {
+		return err
 	}
-	return nil
+
+	table = mdp.partitionTable(table, locate)
+
+	copiedKey := make(map[string]any)
+	for k, v := range key {
+		copiedKey[k] = v
+	}
+
+	return mdp.send(mdp.obtainHandlerByKey(routeKey), InsertRequest{
+		Table:  table,
+		Data:   copiedKey,
+		Delete: true,
+	})
+}
+
+// upsertToMysqlDb 与 deleteFromMysqlDb 配合使用，同一行的写入和删除落到同一个处理器
+func (mdp *Pool) upsertToMysqlDb(table string, data map[string]any, routeKey string) error {
+	if routed, err := mdp.routeShards(table, data, func(pool *Pool) error {
+		return pool.upsertToMysqlDb(table, data, routeKey)
+	}); routed {
+		return err
+	}
+
+	table = mdp.partitionTable(table, data)
+
+	copiedData := make(map[string]any)
+	for k, v := range data {
+		copiedData[k] = v
+	}
+
+	return mdp.send(mdp.obtainHandlerByKey(routeKey), InsertRequest{
+		Table: table,
+		Data:  copiedData,
+	})
 }
 
 func (mdp *Pool) createTable(sqlStatement string) error {
@@ -134,27 +290,24 @@ func (mdp *Pool) createTable(sqlStatement string) error {
 
 	err = element.client.CreateTable(sqlStatement)
 	if err != nil {
-		return fmt.Errorf("创建表失败: %v", err)
+		return fmt.Errorf("创建表失败: %w", err)
 	}
 
 	return nil
 }
 
 func (mdp *Pool) getCount(table string, hostname string, serialNumber string) (string, int, error) {
-	handler := mdp.obtainHandler()
-	sqlQuery := fmt.Sprintf("SELECT boot_time, boot_count FROM %s WHERE hostname = ? AND serial_number = ?", table)
-
-	// 初始化数据库连接
-	err := handler.client.Init()
-	if err != nil {
-		mdp.log.E("初始化客户端失败: %v", err)
-		return "", -1, fmt.Errorf("初始化客户端失败: %v", err)
+	if err := ValidateIdentifier("表名", table); err != nil {
+		return "", -1, err
 	}
 
-	// 查询数据库
+	sqlQuery := fmt.Sprintf("SELECT boot_time, boot_count FROM %s WHERE hostname = ? AND serial_number = ?", quoteIdentifier(table))
+
+	// 查询数据库，分片表按主键定位分片
 	var bootTime string
 	var bootCount int
-	err = handler.client.QueryRow(sqlQuery, hostname, serialNumber).Scan(&bootTime, &bootCount)
+	row := map[string]any{"hostname": hostname, "serial_number": serialNumber}
+	err := mdp.queryShards(table, row, sqlQuery, []any{hostname, serialNumber}, &bootTime, &bootCount)
 	if err != nil {
 		return "", -1, err
 	}
@@ -163,9 +316,17 @@ func (mdp *Pool) getCount(table string, hostname string, serialNumber string) (s
 }
 
 func (mdp *Pool) handleMysqlDbChan(handler *Handler) {
+	defer mdp.stopped.Done()
+
 	var writeBuffer []InsertRequest
 	for {
-		value := <-handler.channel
+		var value InsertRequest
+		select {
+		case value = <-handler.channel:
+		case <-mdp.stop:
+			mdp.shutdownHandler(handler, writeBuffer)
+			return
+		}
 
 		var buffer []InsertRequest
 		mdp.handlerLock.Lock()
@@ -179,15 +340,39 @@ func (mdp *Pool) handleMysqlDbChan(handler *Handler) {
 		buffer = writeBuffer
 		mdp.handlerLock.Unlock()
 
-		err := handler.client.Init()
-		if err != nil {
-			mdp.log.E("初始化客户端失败: %v", err)
-			continue
-		}
-		err = handler.client.RequestBatch(&buffer)
-		if err != nil {
-			mdp.log.E("批量请求失败: %v", err)
-			continue
+		// 写入失败时不再读取新数据，按退避重试；通道写满后阻塞上游，缓冲区不会无限增长。
+		// 连接不可用时一直重试，其余错误（DDL 失败、LOAD DATA 被拒绝等）重试 mysql_flush_max_retries 次后整批转入失败处理
+		backoff := minFlushBackoff
+		retries := 0
+		for {
+			err := mdp.flush(handler, buffer)
+			if err == nil {
+				break
+			}
+
+			if !isUnavailable(err) {
+				retries++
+			}
+
+			if retries >= flushMaxRetries() {
+				mdp.log.E("写入 %s 重试 %d 次仍失败，丢弃 %d 条数据：%v", mdp.dbInfo.name, retries, len(buffer), err)
+				metrics.Add("mysql_flush_abandoned", 1)
+				for _, req := range buffer {
+					rejectHandler(mdp.dbInfo.name, RejectedRequest{Request: req, Err: err})
+				}
+
+				break
+			}
+
+			metrics.Add("mysql_flush_retries", 1)
+			select {
+			case <-mdp.stop:
+				mdp.shutdownHandler(handler, buffer)
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff = min(backoff*2, maxFlushBackoff)
 		}
 
 		mdp.handlerLock.Lock()
@@ -197,6 +382,87 @@ func (mdp *Pool) handleMysqlDbChan(handler *Handler) {
 	}
 }
 
+// shutdownHandler 关闭前写完通道和缓冲区中剩余的数据
+func (mdp *Pool) shutdownHandler(handler *Handler, writeBuffer []InsertRequest) {
+	for len(handler.channel) > 0 {
+		writeBuffer = append(writeBuffer, <-handler.channel)
+	}
+
+	if len(writeBuffer) > 0 && mdp.flush(handler, writeBuffer) != nil {
+		mdp.log.W("连接池关闭，丢弃 %d 条未写入数据：%s", len(writeBuffer), mdp.dbInfo.name)
+	}
+
+	handler.client.Close()
+}
+
+var errClientUnavailable = errors.New("MySQL 连接不可用")
+
+// isUnavailable 连接或主库不可用，数据本身没有问题，应一直重试
+func isUnavailable(err error) bool {
+	return errors.Is(err, errClientUnavailable) || needsFailover(err)
+}
+
+func flushMaxRetries() int {
+	if retries := config.GetBaseConfig().MysqlFlushMaxRetries; retries > 0 {
+		return retries
+	}
+
+	return defaultFlushMaxRetries
+}
+
+// flush 写入缓冲区，返回 error 时缓冲区需保留以便重试
+func (mdp *Pool) flush(handler *Handler, buffer []InsertRequest) error {
+	start := time.Now()
+	defer func() {
+		metrics.Observe("mysql_flush_latency", time.Since(start))
+		metrics.Observe("mysql_flush_latency."+mdp.dbInfo.name, time.Since(start))
+	}()
+
+	err := handler.client.Init()
+	if err != nil {
+		mdp.log.E("初始化客户端失败: %v", err)
+		return fmt.Errorf("%w：%v", errClientUnavailable, err)
+	}
+
+	rejected, err := handler.client.RequestBatch(&buffer)
+	var missingTable *missingTableError
+	if errors.As(err, &missingTable) {
+		// 表已被删除，缓存失效后重建表再重试一次
+		mdp.log.W("表 %s.%s 不存在，重新建表", mdp.dbInfo.name, missingTable.table)
+		err = mdp.recreateTable(missingTable.table)
+		if errors.Is(err, errNoSchema) {
+			// 无法重建的表，其数据转入失败处理，其余数据照常写入
+			var kept []InsertRequest
+			for _, req := range buffer {
+				if req.Table == missingTable.table {
+					rejectHandler(mdp.dbInfo.name, RejectedRequest{Request: req, Err: missingTable})
+				} else {
+					kept = append(kept, req)
+				}
+			}
+
+			buffer = kept
+			err = nil
+		}
+
+		if err == nil {
+			rejected, err = handler.client.RequestBatch(&buffer)
+		}
+	}
+
+	if err != nil {
+		mdp.log.E("批量请求失败: %v", err)
+		handler.client.MarkFailed(err)
+		return err
+	}
+
+	for _, r := range rejected {
+		rejectHandler(mdp.dbInfo.name, r)
+	}
+
+	return nil
+}
+
 func (mdp *Pool) canInsertBatch(writeBuffer []InsertRequest) bool {
 
 	return len(writeBuffer) >= config.GetBaseConfig().MysqlMaxBufferSize || time.Now().After(mdp.lastWriteTime.Add(time.Duration(config.GetBaseConfig().MysqlMaxIntervalTime)*time.Second))
@@ -0,0 +1,204 @@
+package mysql
+
+import (
+	"errors"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"testing"
+	"time"
+)
+
+// captureRejects 收集转入失败处理的请求，测试结束时恢复默认处理
+func captureRejects(t *testing.T) chan RejectedRequest {
+	t.Helper()
+
+	rejects := make(chan RejectedRequest, 100)
+	SetRejectHandler(func(db string, rejected RejectedRequest) {
+		rejects <- rejected
+	})
+	t.Cleanup(func() {
+		SetRejectHandler(nil)
+	})
+
+	return rejects
+}
+
+// holdBuffer 使缓冲区写满 mysql_max_buffer_size 后才写入，而不是收到第一条就写入
+func holdBuffer(pool *Pool) {
+	pool.handlerLock.Lock()
+	pool.lastWriteTime = time.Now()
+	pool.handlerLock.Unlock()
+}
+
+func TestFlushRejectsUnconvertibleRows(t *testing.T) {
+	loadTestConfig(t, map[string]any{"base": map[string]any{"mysql_max_buffer_size": 4}})
+	rejects := captureRejects(t)
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id", "name"}})
+	pool := newTestPool(t, db, 1)
+	holdBuffer(pool)
+
+	rows := []map[string]any{
+		{"id": int64(1), "name": "eth0"},
+		{"id": int64(2), "name": map[string]any{"nested": true}},
+		{"id": int64(3), "name": "eth2"},
+		{"id": int64(4), "name": "eth3"},
+	}
+
+	for _, row := range rows {
+		if err := pool.writeToMysqlDb("port", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case rejected := <-rejects:
+		if rejected.Request.Data["id"] != int64(2) {
+			t.Fatalf("转入失败处理的行不符：%v", rejected.Request.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("无法转换的行没有转入失败处理")
+	}
+
+	pool.close()
+	if got := server.insertedRows(); got != 3 {
+		t.Fatalf("写入 %d 行，期望 3 行", got)
+	}
+
+	if len(rejects) != 0 {
+		t.Fatalf("多余的失败请求：%d", len(rejects))
+	}
+}
+
+func TestFlushGivesUpAfterMaxRetries(t *testing.T) {
+	loadTestConfig(t, map[string]any{"base": map[string]any{
+		"mysql_max_buffer_size":   3,
+		"mysql_flush_max_retries": 2,
+	}})
+	rejects := captureRejects(t)
+
+	backoff := minFlushBackoff
+	minFlushBackoff = time.Millisecond
+	t.Cleanup(func() {
+		minFlushBackoff = backoff
+	})
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id"}})
+	server.failInsert = &mysqlDriver.MySQLError{Number: 1142, Message: "INSERT command denied"}
+	pool := newTestPool(t, db, 1)
+	holdBuffer(pool)
+
+	for i := 0; i < 3; i++ {
+		if err := pool.writeToMysqlDb("port", map[string]any{"id": int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case rejected := <-rejects:
+			var mysqlErr *mysqlDriver.MySQLError
+			if !errors.As(rejected.Err, &mysqlErr) || mysqlErr.Number != 1142 {
+				t.Fatalf("失败原因不符：%v", rejected.Err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("重试次数用尽后没有转入失败处理")
+		}
+	}
+
+	if inserts := len(server.statements("INSERT INTO")); inserts != 2 {
+		t.Fatalf("尝试写入 %d 次，期望 2 次", inserts)
+	}
+}
+
+// 处理器重试期间通道已满，阻塞的 send 不能妨碍 close
+func TestCloseWhileSendBlocked(t *testing.T) {
+	loadTestConfig(t, map[string]any{"base": map[string]any{
+		"mysql_max_buffer_size":   1,
+		"mysql_pool_channel_size": 1,
+		"mysql_flush_max_retries": 1000,
+	}})
+	captureRejects(t)
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id"}})
+	server.failInsert = &mysqlDriver.MySQLError{Number: 1142, Message: "INSERT command denied"}
+	pool := newTestPool(t, db, 1)
+
+	blocked := make(chan error)
+	go func() {
+		for i := 0; ; i++ {
+			if err := pool.writeToMysqlDb("port", map[string]any{"id": int64(i)}); err != nil {
+				blocked <- err
+				return
+			}
+		}
+	}()
+
+	// 等待处理器进入重试、通道写满
+	for len(server.statements("INSERT INTO")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		pool.close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close 被阻塞的 send 卡住")
+	}
+
+	select {
+	case err := <-blocked:
+		if !errors.Is(err, errPoolClosed) {
+			t.Fatalf("关闭后 send 返回 %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send 在关闭后仍阻塞")
+	}
+}
+
+// 处理器数与 mysql_max_open_conns 相同时，各处理器的事务占满连接，写入不能再申请新连接
+func TestPoolSizeEqualToMaxOpenConns(t *testing.T) {
+	const poolSize = 10
+	const requests = 200
+
+	loadTestConfig(t, map[string]any{"base": map[string]any{
+		"mysql_pool_size":       poolSize,
+		"mysql_max_open_conns":  poolSize,
+		"mysql_max_buffer_size": 5,
+	}})
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id", "name"}})
+	db.SetMaxOpenConns(poolSize)
+	server.delay = 20 * time.Millisecond
+
+	pool := newTestPool(t, db, poolSize)
+	for i := 0; i < requests; i++ {
+		if err := pool.writeToMysqlDb("port", map[string]any{"id": int64(i), "name": "eth"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pool.close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("写入未完成，处理器可能在等待连接")
+	}
+
+	if rows := server.insertedRows(); rows != requests {
+		t.Fatalf("写入 %d 行，期望 %d 行", rows, requests)
+	}
+
+	if server.maxOpen > poolSize {
+		t.Fatalf("同时打开 %d 个连接，超过上限 %d", server.maxOpen, poolSize)
+	}
+}
@@ -0,0 +1,241 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"sync"
+	"time"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const (
+	defaultMaxOpenConns    = 10
+	defaultMaxIdleConns    = 2
+	defaultConnMaxLifetime = 120
+	// 连接预算不足时等待其他连接池释放的最长时间
+	connBudgetWait = 30 * time.Second
+)
+
+var registryLog = log.NewLog("MPR")
+
+// 进程内共享的连接池，所有消费者按实例和库名复用，与 influx.obtainPool 一致
+var sharedDbPool = make(map[string]*Pool)
+var poolLock = sync.Mutex{}
+var janitorOnce sync.Once
+
+// obtainPool 按 mysql_routes 选择库所在的实例
+func obtainPool(dbName string) *Pool {
+	endpoint, cfg := config.ResolveMysqlEndpoint(dbName)
+	key := endpoint + "/" + dbName
+
+	poolLock.Lock()
+	defer poolLock.Unlock()
+
+	pool, ok := sharedDbPool[key]
+	if !ok {
+		pool = NewPool(config.GetBaseConfig().MysqlPoolSize, dbName, cfg.Addresses(), cfg.User, cfg.Pwd, cfg.Tls, false)
+		pool.endpoint = endpoint
+		sharedDbPool[key] = pool
+		metrics.Set("mysql_pools", int64(len(sharedDbPool)))
+	}
+
+	pool.touch()
+	janitorOnce.Do(startPoolJanitor)
+	return pool
+}
+
+// obtainShardPool 分片使用的连接池，直接写入指定实例，不再做分片路由
+func obtainShardPool(endpoint string, dbName string) *Pool {
+	cfg := config.Get().MysqlEndpoints[endpoint]
+	key := "shard:" + endpoint + "/" + dbName
+
+	poolLock.Lock()
+	defer poolLock.Unlock()
+
+	pool, ok := sharedDbPool[key]
+	if !ok {
+		pool = NewPool(config.GetBaseConfig().MysqlPoolSize, dbName, cfg.Addresses(), cfg.User, cfg.Pwd, cfg.Tls, false)
+		pool.endpoint = endpoint
+		pool.shard = true
+		sharedDbPool[key] = pool
+		metrics.Set("mysql_pools", int64(len(sharedDbPool)))
+	}
+
+	pool.touch()
+	return pool
+}
+
+// Close 停止前调用，关闭所有连接池，各处理器写完缓冲的数据后退出；
+// 连接池仍保留在表中，之后的写入返回 errPoolClosed
+func Close() {
+	poolLock.Lock()
+	var pools []*Pool
+	for _, pool := range sharedDbPool {
+		pools = append(pools, pool)
+	}
+	poolLock.Unlock()
+
+	for _, pool := range pools {
+		pool.close()
+	}
+}
+
+// startPoolJanitor 定期关闭长时间未使用的连接池，释放其连接
+func startPoolJanitor() {
+	timeout := time.Duration(config.GetBaseConfig().MysqlPoolIdleTimeout) * time.Second
+	if timeout <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			evictIdlePools(timeout)
+		}
+	}()
+}
+
+func evictIdlePools(timeout time.Duration) {
+	var evicted []*Pool
+
+	poolLock.Lock()
+	for key, pool := range sharedDbPool {
+		if time.Since(pool.lastUsedTime()) > timeout {
+			delete(sharedDbPool, key)
+			evicted = append(evicted, pool)
+		}
+	}
+	metrics.Set("mysql_pools", int64(len(sharedDbPool)))
+	poolLock.Unlock()
+
+	for _, pool := range evicted {
+		registryLog.I("关闭空闲连接池：%s/%s", pool.endpoint, pool.dbInfo.name)
+		metrics.Add("mysql_pools_evicted", 1)
+		pool.close()
+	}
+}
+
+// sharedDb 同一数据源的所有 Client 共用一个 sql.DB
+type sharedDb struct {
+	db    *sql.DB
+	refs  int
+	conns int
+}
+
+var sharedDbs = make(map[string]*sharedDb)
+var sharedDbLock = sync.Mutex{}
+var reservedConns int
+
+// budgetReleased 归还预算时关闭并替换，用于唤醒等待预算的调用方
+var budgetReleased = make(chan struct{})
+
+// openSharedDb 打开或复用数据源对应的 sql.DB。
+// 新建时按 mysql_max_open_conns 从全局预算 mysql_max_total_conns 中预留连接数，
+// 预算不足时等待其他数据源释放，超过 connBudgetWait 仍不足时返回错误。
+func openSharedDb(source string) (*sql.DB, error) {
+	return openSharedDbWithin(source, connBudgetWait)
+}
+
+func openSharedDbWithin(source string, wait time.Duration) (*sql.DB, error) {
+	sharedDbLock.Lock()
+	defer sharedDbLock.Unlock()
+
+	deadline := time.Now().Add(wait)
+	waited := false
+	for {
+		if shared, ok := sharedDbs[source]; ok {
+			shared.refs++
+			return shared.db, nil
+		}
+
+		db, err := reserveSharedDb(source)
+		if !errors.Is(err, errConnBudget) || time.Now().After(deadline) {
+			return db, err
+		}
+
+		if !waited {
+			waited = true
+			metrics.Add("mysql_conn_budget_waits", 1)
+		}
+
+		released := budgetReleased
+		sharedDbLock.Unlock()
+		select {
+		case <-released:
+		case <-time.After(time.Until(deadline)):
+		}
+		sharedDbLock.Lock()
+	}
+}
+
+var errConnBudget = errors.New("超出 MySQL 连接预算")
+
+// reserveSharedDb 预算足够时打开新的 sql.DB，调用方持有 sharedDbLock
+func reserveSharedDb(source string) (*sql.DB, error) {
+	base := config.GetBaseConfig()
+	maxOpen := base.MysqlMaxOpenConns
+	if maxOpen <= 0 {
+		maxOpen = defaultMaxOpenConns
+	}
+
+	maxIdle := base.MysqlMaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdleConns
+	}
+
+	lifetime := base.MysqlConnMaxLifetime
+	if lifetime <= 0 {
+		lifetime = defaultConnMaxLifetime
+	}
+
+	if base.MysqlMaxTotalConns > 0 && reservedConns+maxOpen > base.MysqlMaxTotalConns {
+		metrics.Add("mysql_conn_budget_exhausted", 1)
+		return nil, fmt.Errorf("%w：已预留 %d，上限 %d", errConnBudget, reservedConns, base.MysqlMaxTotalConns)
+	}
+
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(time.Duration(lifetime) * time.Second)
+	if base.MysqlConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(time.Duration(base.MysqlConnMaxIdleTime) * time.Second)
+	}
+
+	sharedDbs[source] = &sharedDb{db: db, refs: 1, conns: maxOpen}
+	reservedConns += maxOpen
+	metrics.Set("mysql_conns_reserved", int64(reservedConns))
+	return db, nil
+}
+
+// releaseSharedDb 引用归零时关闭 sql.DB 并归还预算
+func releaseSharedDb(source string) {
+	sharedDbLock.Lock()
+	defer sharedDbLock.Unlock()
+
+	shared, ok := sharedDbs[source]
+	if !ok {
+		return
+	}
+
+	shared.refs--
+	if shared.refs > 0 {
+		return
+	}
+
+	delete(sharedDbs, source)
+	reservedConns -= shared.conns
+	metrics.Set("mysql_conns_reserved", int64(reservedConns))
+	_ = shared.db.Close()
+
+	close(budgetReleased)
+	budgetReleased = make(chan struct{})
+}
@@ -0,0 +1,157 @@
+package mysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	"venu-data/config"
+)
+
+func TestOpenSharedDbWaitsForBudget(t *testing.T) {
+	loadTestConfig(t, map[string]any{"base": map[string]any{"mysql_max_total_conns": 10, "mysql_max_open_conns": 10}})
+
+	if _, err := openSharedDbWithin("u:p@tcp(127.0.0.1:1)/a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openSharedDbWithin("u:p@tcp(127.0.0.1:1)/b", 0); !errors.Is(err, errConnBudget) {
+		t.Fatalf("预算不足时应返回 errConnBudget：%v", err)
+	}
+
+	// 同一数据源复用，不占用预算
+	if _, err := openSharedDbWithin("u:p@tcp(127.0.0.1:1)/a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := openSharedDbWithin("u:p@tcp(127.0.0.1:1)/b", 5*time.Second)
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	releaseSharedDb("u:p@tcp(127.0.0.1:1)/a")
+	select {
+	case <-done:
+		t.Fatal("仍有引用时不应归还预算")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	releaseSharedDb("u:p@tcp(127.0.0.1:1)/a")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("归还预算后应打开成功：%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("归还预算后仍在等待")
+	}
+
+	releaseSharedDb("u:p@tcp(127.0.0.1:1)/b")
+	if reservedConns != 0 {
+		t.Fatalf("预算未全部归还：%d", reservedConns)
+	}
+}
+
+func TestClosedClientDoesNotReconnect(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	client := NewClient("test", []string{"127.0.0.1:1"}, "u", "p", config.MysqlTlsConfig{}, false)
+	client.Close()
+	if err := client.Init(); !errors.Is(err, errClientClosed) {
+		t.Fatalf("关闭后 Init 应返回 errClientClosed：%v", err)
+	}
+
+	if len(sharedDbs) != 0 {
+		t.Fatalf("关闭后不应持有共享连接：%v", sharedDbs)
+	}
+}
+
+func TestCloseFlushesAllPools(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id"}})
+	pool := newTestPool(t, db, 2)
+	holdBuffer(pool)
+
+	poolLock.Lock()
+	sharedDbPool["test-close"] = pool
+	poolLock.Unlock()
+	t.Cleanup(func() {
+		poolLock.Lock()
+		delete(sharedDbPool, "test-close")
+		poolLock.Unlock()
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := pool.writeToMysqlDb("port", map[string]any{"id": int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Close()
+	if rows := server.insertedRows(); rows != 5 {
+		t.Fatalf("关闭时写入 %d 行，期望 5 行", rows)
+	}
+
+	if err := pool.writeToMysqlDb("port", map[string]any{"id": int64(5)}); !errors.Is(err, errPoolClosed) {
+		t.Fatalf("关闭后写入应返回 errPoolClosed：%v", err)
+	}
+}
+
+func TestObtainPoolRoutes(t *testing.T) {
+	loadTestConfig(t, map[string]any{
+		"base": map[string]any{"mysql_pool_size": 1},
+		"mysql_endpoints": map[string]any{
+			"logs": map[string]any{"host": "10.0.0.2", "port": "3306"},
+		},
+		"mysql_routes": []map[string]any{{"db": "log_*", "endpoint": "logs"}},
+	})
+
+	var keys []string
+	t.Cleanup(func() {
+		poolLock.Lock()
+		var pools []*Pool
+		for _, key := range keys {
+			pools = append(pools, sharedDbPool[key])
+			delete(sharedDbPool, key)
+		}
+		poolLock.Unlock()
+
+		for _, pool := range pools {
+			pool.close()
+		}
+	})
+
+	tests := []struct {
+		db       string
+		endpoint string
+		hosts    []string
+	}{
+		{db: "log_app", endpoint: "logs", hosts: []string{"10.0.0.2:3306"}},
+		{db: "log_web", endpoint: "logs", hosts: []string{"10.0.0.2:3306"}},
+		{db: "metrics", endpoint: config.DefaultMysqlEndpoint, hosts: []string{"127.0.0.1:3306"}},
+	}
+
+	for _, tt := range tests {
+		pool := obtainPool(tt.db)
+		keys = append(keys, tt.endpoint+"/"+tt.db)
+		if pool.endpoint != tt.endpoint || pool.dbInfo.name != tt.db || !reflect.DeepEqual(pool.dbInfo.hosts, tt.hosts) {
+			t.Errorf("%s：实例 %s，库 %s，地址 %v，期望实例 %s，地址 %v", tt.db, pool.endpoint, pool.dbInfo.name, pool.dbInfo.hosts, tt.endpoint, tt.hosts)
+		}
+
+		// 同一库复用连接池
+		if again := obtainPool(tt.db); again != pool {
+			t.Errorf("%s：再次获取时应复用连接池", tt.db)
+		}
+	}
+
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	for _, key := range keys {
+		if sharedDbPool[key] == nil {
+			t.Errorf("连接池未按 %s 登记", key)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/my-dev-lib/pretty-log-go"
+	"path"
+	"strings"
+	"time"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const (
+	defaultRetentionInterval  = 3600
+	defaultRetentionChunkSize = 1000
+)
+
+// RetentionScheduler 按配置的规则定期清理过期数据，取代每次写入后的全表删除
+type RetentionScheduler struct {
+	conf config.RetentionConfig
+	dbs  map[string]*sql.DB
+	log  *log.Log
+}
+
+func NewRetentionScheduler(conf config.RetentionConfig) *RetentionScheduler {
+	if conf.Interval <= 0 {
+		conf.Interval = defaultRetentionInterval
+	}
+
+	if conf.ChunkSize <= 0 {
+		conf.ChunkSize = defaultRetentionChunkSize
+	}
+
+	return &RetentionScheduler{conf: conf, dbs: make(map[string]*sql.DB), log: log.NewLog("MRS")}
+}
+
+// StartRetention 没有配置规则时不启动
+func StartRetention() {
+	conf := config.GetMysqlRetentionConfig()
+	if len(conf.Rules) == 0 {
+		return
+	}
+
+	go NewRetentionScheduler(conf).Run()
+}
+
+func (rs *RetentionScheduler) Run() {
+	ticker := time.NewTicker(time.Duration(rs.conf.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		rs.RunOnce()
+		<-ticker.C
+	}
+}
+
+// matchRule 返回第一条匹配的规则
+func (rs *RetentionScheduler) matchRule(db string, table string) *config.RetentionRule {
+	for i := range rs.conf.Rules {
+		rule := &rs.conf.Rules[i]
+		dbMatched, _ := path.Match(rule.Db, db)
+		tableMatched, _ := path.Match(rule.Table, table)
+		if dbMatched && tableMatched {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// RunOnce 依次清理每个 MySQL 实例
+func (rs *RetentionScheduler) RunOnce() {
+	var total int64
+	for endpoint, cfg := range config.Get().MysqlEndpoints {
+		db, err := connectPrimary(rs.dbs, cfg)
+		if err != nil {
+			rs.log.E("连接数据库 %s 失败：%v", endpoint, err)
+			continue
+		}
+
+		total += rs.runEndpoint(endpoint, db)
+	}
+
+	metrics.Add("mysql_retention_runs", 1)
+	if total > 0 {
+		rs.log.I("过期数据清理完成，共 %d 行", total)
+	}
+}
+
+// candidateTables 只清理本进程写入过的表和规则中明确列出（不含通配符）的表，不扫描实例上的其他库
+func (rs *RetentionScheduler) candidateTables(endpoint string) map[string]map[string]bool {
+	tables := managedTables(endpoint)
+	for _, rule := range rs.conf.Rules {
+		if rule.Ttl > 0 {
+			addExplicitTable(tables, endpoint, rule.Db, rule.Table)
+		}
+	}
+
+	return tables
+}
+
+func (rs *RetentionScheduler) runEndpoint(endpoint string, conn *sql.DB) int64 {
+	candidates := rs.candidateTables(endpoint)
+
+	// 只取规则中出现的时间列，规则的列不存在时跳过该表
+	var args []any
+	var columnPlaceholders []string
+	seen := make(map[string]bool)
+	for _, rule := range rs.conf.Rules {
+		if rule.Ttl > 0 && rule.Column != "" && !seen[rule.Column] {
+			seen[rule.Column] = true
+			args = append(args, rule.Column)
+			columnPlaceholders = append(columnPlaceholders, "?")
+		}
+	}
+
+	if len(args) == 0 || len(candidates) == 0 {
+		return 0
+	}
+
+	var dbPlaceholders []string
+	for db := range candidates {
+		args = append(args, db)
+		dbPlaceholders = append(dbPlaceholders, "?")
+	}
+
+	//noinspection ALL
+	rows, err := conn.Query("SELECT c.table_schema, c.table_name, c.column_name, IFNULL(t.create_options, '') FROM information_schema.columns c "+
+		"JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name "+
+		"WHERE t.table_type = 'BASE TABLE' "+
+		"AND c.column_name IN ("+strings.Join(columnPlaceholders, ", ")+") "+
+		"AND c.table_schema IN ("+strings.Join(dbPlaceholders, ", ")+")", args...)
+	if err != nil {
+		rs.log.E("查询 %s 表结构失败：%v", endpoint, err)
+		return 0
+	}
+
+	type target struct {
+		db    string
+		table string
+		rule  *config.RetentionRule
+	}
+
+	var targets []target
+	for rows.Next() {
+		var db, table, column, options string
+		if err := rows.Scan(&db, &table, &column, &options); err != nil {
+			rs.log.E("读取表结构失败：%v", err)
+			break
+		}
+
+		// 分区表由 PartitionManager 按分区删除
+		if !candidates[db][table] || isPartitionedTable(db, table, strings.Contains(strings.ToLower(options), "partitioned")) {
+			continue
+		}
+
+		rule := rs.matchRule(db, table)
+		if rule == nil || rule.Ttl <= 0 || rule.Column != column {
+			continue
+		}
+
+		targets = append(targets, target{db: db, table: table, rule: rule})
+	}
+
+	_ = rows.Close()
+
+	var total int64
+	for _, t := range targets {
+		purged, err := rs.purge(conn, t.db, t.table, t.rule)
+		total += purged
+		if err != nil {
+			rs.log.W("清理 %s/%s.%s 失败：%v", endpoint, t.db, t.table, err)
+			metrics.Add("mysql_retention_errors", 1)
+		}
+	}
+
+	return total
+}
+
+// purge 分块删除，每次最多 ChunkSize 行，避免大事务和长时间锁表
+func (rs *RetentionScheduler) purge(conn *sql.DB, db string, table string, rule *config.RetentionRule) (int64, error) {
+	//noinspection ALL
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s < NOW() - INTERVAL ? SECOND LIMIT ?",
+		quoteTable(db, table), quoteIdentifier(rule.Column))
+
+	var total int64
+	for {
+		result, err := conn.Exec(stmt, rule.Ttl, rs.conf.ChunkSize)
+		if err != nil {
+			return total, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		if affected > 0 {
+			total += affected
+			metrics.Add("mysql_retention_purged_rows", affected)
+			metrics.Add(fmt.Sprintf("mysql_retention_purged_rows.%s.%s", db, table), affected)
+		}
+
+		if affected < int64(rs.conf.ChunkSize) {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package mysql
+
+import (
+	"testing"
+	"venu-data/config"
+)
+
+func TestRetentionCandidateTables(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	schemaLock.Lock()
+	schemaCache[schemaKey(config.DefaultMysqlEndpoint, "switch", "port")] = &tableSchema{endpoint: config.DefaultMysqlEndpoint, db: "switch", table: "port", created: true}
+	schemaCache[schemaKey(config.DefaultMysqlEndpoint, "switch", "pending")] = &tableSchema{endpoint: config.DefaultMysqlEndpoint, db: "switch", table: "pending"}
+	schemaCache[schemaKey("other", "switch", "remote")] = &tableSchema{endpoint: "other", db: "switch", table: "remote", created: true}
+	schemaLock.Unlock()
+
+	defer func() {
+		schemaLock.Lock()
+		schemaCache = make(map[string]*tableSchema)
+		schemaLock.Unlock()
+	}()
+
+	rs := NewRetentionScheduler(config.RetentionConfig{Rules: []config.RetentionRule{
+		{Db: "*", Table: "*", Column: "update_at", Ttl: 60},
+		{Db: "audit", Table: "login_log", Column: "create_at", Ttl: 60},
+		{Db: "audit", Table: "kept", Column: "create_at"},
+	}})
+
+	endpoint, _ := config.ResolveMysqlEndpoint("switch")
+	candidates := rs.candidateTables(endpoint)
+
+	expected := map[string]map[string]bool{
+		"switch": {"port": true},
+		"audit":  {"login_log": true},
+	}
+
+	if len(candidates) != len(expected) {
+		t.Fatalf("候选表不符：%v", candidates)
+	}
+
+	for db, tables := range expected {
+		if len(candidates[db]) != len(tables) {
+			t.Fatalf("%s 的候选表不符：%v", db, candidates[db])
+		}
+
+		for table := range tables {
+			if !candidates[db][table] {
+				t.Fatalf("缺少候选表 %s.%s：%v", db, table, candidates)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"sort"
+	"strings"
+	"sync"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const (
+	errDupFieldName = 1060
+	errBadField     = 1054
+	errNoSuchTable  = 1146
+	// errPartitionKey 主键或唯一键不包含分区列
+	errPartitionKey = 1503
+)
+
+var errNoSchema = errors.New("没有缓存的建表语句")
+
+// tableSchema 记录建表语句，表被删除后可用其重建
+type tableSchema struct {
+	endpoint string
+	db       string
+	table    string
+	ddl      string
+	// partition 分区子句，为空时不分区
+	partition string
+	created   bool
+}
+
+// statement 建表语句，分区子句作为表选项追加在最后
+func (s *tableSchema) statement() string {
+	if s.partition == "" {
+		return s.ddl
+	}
+
+	return strings.TrimSuffix(strings.TrimSpace(s.ddl), ";") + " " + s.partition
+}
+
+// isPartitionKeyError 分区列不在主键中，或建表语句中没有该列
+func isPartitionKeyError(err error) bool {
+	var mysqlErr *mysqlDriver.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == errPartitionKey || mysqlErr.Number == errBadField)
+}
+
+// 进程内的表结构缓存，每张表只执行一次建表语句
+var schemaCache = make(map[string]*tableSchema)
+var schemaLock = sync.Mutex{}
+
+func schemaKey(endpoint string, db string, table string) string {
+	return endpoint + "/" + db + "." + table
+}
+
+// missingTableError 写入时表不存在，缓冲区保留，重建表后重试
+type missingTableError struct {
+	table string
+	err   error
+}
+
+func (e *missingTableError) Error() string {
+	return fmt.Sprintf("表 %s 不存在：%v", e.table, e.err)
+}
+
+func (e *missingTableError) Unwrap() error {
+	return e.err
+}
+
+func isNoSuchTable(err error) bool {
+	var mysqlErr *mysqlDriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable
+}
+
+// ensureTable 表未创建过时才生成并执行建表语句
+func (mdp *Pool) ensureTable(table string, ddl func() string) error {
+	if routed, err := mdp.ensureShardTables(table, ddl); routed {
+		return err
+	}
+
+	key := schemaKey(mdp.endpoint, mdp.dbInfo.name, table)
+
+	schemaLock.Lock()
+	schema, ok := schemaCache[key]
+	if ok && schema.created {
+		schemaLock.Unlock()
+		return nil
+	}
+
+	if !ok {
+		schema = &tableSchema{endpoint: mdp.endpoint, db: mdp.dbInfo.name, table: table, ddl: ddl(), partition: partitionClause(mdp.dbInfo.name, table)}
+		schemaCache[key] = schema
+	}
+
+	statement := schema.statement()
+	partitioned := schema.partition != ""
+	schemaLock.Unlock()
+
+	err := mdp.createTable(statement)
+	if err != nil && partitioned && isPartitionKeyError(err) {
+		// 把分区列加入主键会让 ON DUPLICATE KEY 按新主键去重，同一行会重复写入，因此改为不分区
+		mdp.log.W("表 %s.%s 的主键不含分区列，不分区：%v", mdp.dbInfo.name, table, err)
+		metrics.Add("mysql_partition_skipped", 1)
+
+		schemaLock.Lock()
+		schema.partition = ""
+		schemaLock.Unlock()
+
+		err = mdp.createTable(schema.ddl)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	metrics.Add("mysql_ddl_executed", 1)
+
+	schemaLock.Lock()
+	schema.created = true
+	schemaLock.Unlock()
+	return nil
+}
+
+// managedTables 本进程建过（或确认存在）的表，按库分组
+func managedTables(endpoint string) map[string]map[string]bool {
+	schemaLock.Lock()
+	defer schemaLock.Unlock()
+
+	tables := make(map[string]map[string]bool)
+	for _, schema := range schemaCache {
+		if schema.endpoint != endpoint || !schema.created {
+			continue
+		}
+
+		if tables[schema.db] == nil {
+			tables[schema.db] = make(map[string]bool)
+		}
+
+		tables[schema.db][schema.table] = true
+	}
+
+	return tables
+}
+
+// addExplicitTable 规则中明确列出（不含通配符）且路由到 endpoint 的表加入 tables，
+// 与 managedTables 一起作为后台任务可以修改的表，通配规则不会扩大到实例上的其他表
+func addExplicitTable(tables map[string]map[string]bool, endpoint string, db string, table string) {
+	if strings.ContainsAny(db+table, "*?[\\") {
+		return
+	}
+
+	if target, _ := config.ResolveMysqlEndpoint(db); target != endpoint {
+		return
+	}
+
+	if tables[db] == nil {
+		tables[db] = make(map[string]bool)
+	}
+
+	tables[db][table] = true
+}
+
+// recreateTable 表被外部删除后按缓存的建表语句重建
+func (mdp *Pool) recreateTable(table string) error {
+	key := schemaKey(mdp.endpoint, mdp.dbInfo.name, table)
+
+	schemaLock.Lock()
+	schema, ok := schemaCache[key]
+	if ok {
+		schema.created = false
+	}
+	schemaLock.Unlock()
+
+	if !ok {
+		return errNoSchema
+	}
+
+	return mdp.ensureTable(table, func() string { return schema.ddl })
+}
+
+func isUnknownColumn(err error) bool {
+	var mysqlErr *mysqlDriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errBadField
+}
+
+// tableColumns 读取表的列名，表不存在时返回空
+func (dc *Client) tableColumns(table string) (map[string]bool, error) {
+	rows, err := dc.dbClient.Query(
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?", dc.database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+
+		columns[strings.ToLower(column)] = true
+	}
+
+	return columns, rows.Err()
+}
+
+// ensureColumns 表按第一条消息创建，之后的行可能带有新的列，写入前补齐。
+// 须在事务外调用：事务内的 DDL 会隐式提交，且会等待事务自身持有的元数据锁
+func (dc *Client) ensureColumns(table string, rows []map[string]any) error {
+	dc.columnLock.Lock()
+	defer dc.columnLock.Unlock()
+
+	known, ok := dc.columns[table]
+	if !ok {
+		columns, err := dc.tableColumns(table)
+		if err != nil {
+			return err
+		}
+
+		// 表不存在时由写入时的重建逻辑处理
+		if len(columns) == 0 {
+			return nil
+		}
+
+		known = columns
+		dc.columns[table] = known
+	}
+
+	samples := make(map[string]any)
+	for _, row := range rows {
+		for column, value := range row {
+			if known[strings.ToLower(column)] || ValidateIdentifier("列名", column) != nil {
+				continue
+			}
+
+			if samples[column] == nil {
+				samples[column] = value
+			}
+		}
+	}
+
+	if len(samples) == 0 {
+		return nil
+	}
+
+	missing := make([]string, 0, len(samples))
+	for column := range samples {
+		missing = append(missing, column)
+	}
+
+	sort.Strings(missing)
+
+	additions := make([]string, len(missing))
+	for i, column := range missing {
+		columnType := "VARCHAR(255)"
+		if samples[column] != nil {
+			columnType = getColumnType(samples[column], false)
+		}
+
+		additions[i] = fmt.Sprintf("ADD COLUMN %s %s", quoteIdentifier(column), columnType)
+	}
+
+	//noinspection ALL
+	stmt := fmt.Sprintf("ALTER TABLE %s %s", quoteTable(dc.database, table), strings.Join(additions, ", "))
+	if _, err := dc.dbClient.Exec(stmt); err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if !errors.As(err, &mysqlErr) || mysqlErr.Number != errDupFieldName {
+			return fmt.Errorf("表 %s 添加列失败：%w", table, err)
+		}
+
+		// 其他处理器已添加，下次重新读取
+		delete(dc.columns, table)
+		return nil
+	}
+
+	dc.dbLog.I("表 %s 添加列 %s", table, strings.Join(missing, ", "))
+	metrics.Add("mysql_columns_added", int64(len(missing)))
+	for _, column := range missing {
+		known[strings.ToLower(column)] = true
+	}
+
+	return nil
+}
+
+// ensureRequestColumns 按表补齐整批写入请求中的新列
+func (dc *Client) ensureRequestColumns(requests []InsertRequest) error {
+	tables := make(map[string][]map[string]any)
+	var order []string
+	for _, req := range requests {
+		if req.Delete {
+			continue
+		}
+
+		if _, ok := tables[req.Table]; !ok {
+			order = append(order, req.Table)
+		}
+
+		tables[req.Table] = append(tables[req.Table], req.Data)
+	}
+
+	for _, table := range order {
+		if err := dc.ensureColumns(table, tables[table]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forgetColumns 写入报未知列时丢弃缓存，重试前重新读取
+func (dc *Client) forgetColumns(table string) {
+	dc.columnLock.Lock()
+	defer dc.columnLock.Unlock()
+
+	delete(dc.columns, table)
+}
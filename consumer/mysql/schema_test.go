@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestRequestBatchAddsMissingColumns(t *testing.T) {
+	loadTestConfig(t, map[string]any{"base": map[string]any{"mysql_add_columns": true}})
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id", "name"}})
+	client := newTestClient(db)
+
+	requests := []InsertRequest{
+		{Table: "port", Data: map[string]any{"id": int64(1), "name": "a"}},
+		{Table: "port", Data: map[string]any{"id": int64(2), "name": "b", "speed": int64(1000)}},
+		{Table: "port", Data: map[string]any{"id": int64(3), "status": nil}},
+	}
+
+	rejected, err := client.RequestBatch(&requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rejected) != 0 {
+		t.Fatalf("不应拒绝任何行：%v", rejected[0].Err)
+	}
+
+	alters := server.statements("ALTER TABLE")
+	if len(alters) != 1 || alters[0] != "ALTER TABLE `test`.`port` ADD COLUMN `speed` BIGINT, ADD COLUMN `status` VARCHAR(255)" {
+		t.Fatalf("ALTER 语句不符：%v", alters)
+	}
+
+	if inserts := server.statements("INSERT INTO"); len(inserts) != 3 {
+		t.Fatalf("应按列集合分 3 组写入：%v", inserts)
+	}
+
+	// 列已补齐，再次写入不再执行 ALTER
+	if _, err = client.RequestBatch(&requests); err != nil {
+		t.Fatal(err)
+	}
+
+	if alters = server.statements("ALTER TABLE"); len(alters) != 1 {
+		t.Fatalf("不应重复添加列：%v", alters)
+	}
+}
+
+func TestUnknownColumnIsRetried(t *testing.T) {
+	loadTestConfig(t, map[string]any{"base": map[string]any{"mysql_add_columns": true}})
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id"}})
+	client := newTestClient(db)
+
+	// 缓存的列与实际不符时，写入报 1054，整批重试而不是拒绝
+	client.columns["port"] = map[string]bool{"id": true, "speed": true}
+	requests := []InsertRequest{{Table: "port", Data: map[string]any{"id": int64(1), "speed": int64(1)}}}
+
+	rejected, err := client.RequestBatch(&requests)
+	if err == nil || len(rejected) != 0 {
+		t.Fatalf("应返回可重试的错误：%v %v", err, rejected)
+	}
+
+	if _, err = client.RequestBatch(&requests); err != nil {
+		t.Fatalf("重试时应补齐列：%v", err)
+	}
+
+	if alters := server.statements("ALTER TABLE"); len(alters) != 1 {
+		t.Fatalf("重试时应添加列：%v", alters)
+	}
+}
+
+func TestUnknownColumnRejectedByDefault(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	db, server := newFakeDb(t, map[string][]string{"port": {"id", "name"}})
+	client := newTestClient(db)
+
+	requests := []InsertRequest{
+		{Table: "port", Data: map[string]any{"id": int64(1), "name": "a"}},
+		{Table: "port", Data: map[string]any{"id": int64(2), "name": "b", "speed": int64(1000)}},
+		{Table: "port", Data: map[string]any{"id": int64(3), "name": "c"}},
+	}
+
+	rejected, err := client.RequestBatch(&requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rejected) != 1 || rejected[0].Request.Data["id"] != int64(2) || !isUnknownColumn(rejected[0].Err) {
+		t.Fatalf("应只拒绝带有未知列的行：%v", rejected)
+	}
+
+	if alters := server.statements("ALTER TABLE"); len(alters) != 0 {
+		t.Fatalf("默认不应修改表结构：%v", alters)
+	}
+}
@@ -13,7 +13,6 @@ import (
 
 type ServeResourceReaderConsumer struct {
 	log     *pretty_log.Log
-	pools   map[string]*Pool
 	topic   string
 	groupId string
 	id      string
@@ -33,7 +32,6 @@ type ServerResource struct {
 func NewMysqlServeResourceReaderConsumer(topicConf config.TopicConfig) *ServeResourceReaderConsumer {
 	return &ServeResourceReaderConsumer{
 		log:     pretty_log.NewLog("IIC"),
-		pools:   make(map[string]*Pool),
 		topic:   topicConf.Name,
 		groupId: topicConf.GroupID,
 		id:      topicConf.GroupID + "_" + uuid.New().String(),
@@ -51,15 +49,7 @@ func (mc *ServeResourceReaderConsumer) Id() string {
 }
 
 func (mc *ServeResourceReaderConsumer) handlePlus(msg *InsertMessage) {
-	dbName := msg.DbName
-	pool, ok := mc.pools[dbName]
-	cfg := config.Get().MysqlDb
-	poolSize := config.GetBaseConfig().MysqlPoolSize
-	if !ok {
-		pool = NewPool(poolSize, dbName, cfg.Host, cfg.Port, cfg.User, cfg.Pwd, false)
-		pool.init()
-		mc.pools[dbName] = pool
-	}
+	pool := obtainPool(msg.DbName)
 	createSql := `CREATE TABLE IF NOT EXISTS server_resource
 			(
 				hostname        VARCHAR(255),
@@ -73,17 +63,12 @@ func (mc *ServeResourceReaderConsumer) handlePlus(msg *InsertMessage) {
 				status          VARCHAR(255),
 				PRIMARY KEY (hostname, serial_number)
 			);`
-	err := pool.createTable(createSql)
+	err := pool.ensureTable("server_resource", func() string { return createSql })
 	if err != nil {
 		mc.log.E("创建数据库%s表%s失败: %v", msg.DbName, msg.TableName, err)
 	}
 
-	pool2, ok2 := mc.pools["venus_master"]
-	if !ok2 {
-		pool2 = NewPool(poolSize, "venus_master", cfg.Host, cfg.Port, cfg.User, cfg.Pwd, false)
-		pool2.init()
-		mc.pools["venus_master"] = pool2
-	}
+	pool2 := obtainPool("venus_master")
 	hostname := msg.Data["hostname"].(string)
 	serialNumber := msg.Data["serial_number"].(string)
 	bootTime := msg.Data["boot_time"].(string)
@@ -136,6 +121,11 @@ func (mc *ServeResourceReaderConsumer) Consume(msg *base.DataMessage) error {
 		return fmt.Errorf("#InsertConsumer.Consume json 解析错误：%v", err)
 	}
 
+	err = validateInsertMessage(&miMsg)
+	if err != nil {
+		return fmt.Errorf("#ServeResourceReaderConsumer.Consume 消息校验失败：%v", err)
+	}
+
 	mc.handlePlus(&miMsg)
 	return nil
 }
@@ -0,0 +1,216 @@
+package mysql
+
+import (
+	"fmt"
+	"hash/crc32"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"venu-data/config"
+	"venu-data/internal/metrics"
+)
+
+const defaultVirtualNodes = 160
+
+// shardRing 一致性哈希环，每个实例对应多个虚拟节点
+type shardRing struct {
+	hashes    []uint32
+	endpoints []string
+}
+
+func newShardRing(endpoints []string, virtualNodes int) *shardRing {
+	ring := &shardRing{}
+	type node struct {
+		hash     uint32
+		endpoint string
+	}
+
+	var nodes []node
+	for _, endpoint := range endpoints {
+		for i := 0; i < virtualNodes; i++ {
+			hash := crc32.ChecksumIEEE([]byte(endpoint + "#" + strconv.Itoa(i)))
+			nodes = append(nodes, node{hash: hash, endpoint: endpoint})
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].hash < nodes[j].hash })
+	for _, n := range nodes {
+		ring.hashes = append(ring.hashes, n.hash)
+		ring.endpoints = append(ring.endpoints, n.endpoint)
+	}
+
+	return ring
+}
+
+// locate 顺时针找到第一个不小于 key 哈希值的虚拟节点
+func (r *shardRing) locate(key string) string {
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.endpoints[i]
+}
+
+// shardRouter 一张分片表的路由，配置了 previous_endpoints 时迁移期间双写到新旧分片
+type shardRouter struct {
+	key       string
+	current   *shardRing
+	previous  *shardRing
+	endpoints []string
+}
+
+// 按 db.table 缓存路由，未分片的表缓存为 nil
+var shardRouters = make(map[string]*shardRouter)
+var shardLock = sync.Mutex{}
+
+func shardRouterFor(db string, table string) *shardRouter {
+	cacheKey := db + "." + table
+
+	shardLock.Lock()
+	defer shardLock.Unlock()
+
+	if router, ok := shardRouters[cacheKey]; ok {
+		return router
+	}
+
+	var router *shardRouter
+	for _, rule := range config.GetMysqlShardedTables() {
+		dbMatched, _ := path.Match(rule.Db, db)
+		tableMatched, _ := path.Match(rule.Table, table)
+		if !dbMatched || !tableMatched {
+			continue
+		}
+
+		set := config.GetMysqlShardSets()[rule.ShardSet]
+		virtualNodes := set.VirtualNodes
+		if virtualNodes <= 0 {
+			virtualNodes = defaultVirtualNodes
+		}
+
+		router = &shardRouter{key: rule.Key, current: newShardRing(set.Endpoints, virtualNodes)}
+		if len(set.PreviousEndpoints) > 0 {
+			router.previous = newShardRing(set.PreviousEndpoints, virtualNodes)
+		}
+
+		seen := make(map[string]bool)
+		for _, endpoint := range append(append([]string{}, set.Endpoints...), set.PreviousEndpoints...) {
+			if !seen[endpoint] {
+				seen[endpoint] = true
+				router.endpoints = append(router.endpoints, endpoint)
+			}
+		}
+
+		break
+	}
+
+	shardRouters[cacheKey] = router
+	return router
+}
+
+// targets 返回一行数据应写入的实例，双写时可能有两个
+func (r *shardRouter) targets(row map[string]any) ([]string, error) {
+	value, ok := row[r.key]
+	if !ok || value == nil {
+		return nil, fmt.Errorf("缺少分片键 %s", r.key)
+	}
+
+	endpoints := r.locate(fmt.Sprint(value))
+	if len(endpoints) > 1 {
+		metrics.Add("mysql_shard_dual_writes", 1)
+	}
+
+	return endpoints, nil
+}
+
+// readEndpoints 查询一行时依次尝试的实例：有分片键时同 targets，否则为所有分片
+func (r *shardRouter) readEndpoints(row map[string]any) []string {
+	value, ok := row[r.key]
+	if !ok || value == nil {
+		return r.endpoints
+	}
+
+	return r.locate(fmt.Sprint(value))
+}
+
+// locate 返回分片键对应的当前分片，迁移期间旧分片不同时一并返回
+func (r *shardRouter) locate(key string) []string {
+	endpoint := r.current.locate(key)
+	if r.previous == nil {
+		return []string{endpoint}
+	}
+
+	if previous := r.previous.locate(key); previous != endpoint {
+		return []string{endpoint, previous}
+	}
+
+	return []string{endpoint}
+}
+
+// shardReadPools 查询分片表时依次尝试的连接池，未分片的表只查询当前连接池
+func (mdp *Pool) shardReadPools(table string, row map[string]any) []*Pool {
+	if mdp.shard {
+		return []*Pool{mdp}
+	}
+
+	router := shardRouterFor(mdp.dbInfo.name, table)
+	if router == nil {
+		return []*Pool{mdp}
+	}
+
+	var pools []*Pool
+	for _, endpoint := range router.readEndpoints(row) {
+		pools = append(pools, obtainShardPool(endpoint, mdp.dbInfo.name))
+	}
+
+	return pools
+}
+
+// routeShards 分片表的数据交给各分片的连接池，返回 false 表示未分片、由当前连接池处理
+func (mdp *Pool) routeShards(table string, row map[string]any, handle func(pool *Pool) error) (bool, error) {
+	if mdp.shard {
+		return false, nil
+	}
+
+	router := shardRouterFor(mdp.dbInfo.name, table)
+	if router == nil {
+		return false, nil
+	}
+
+	endpoints, err := router.targets(row)
+	if err != nil {
+		return true, err
+	}
+
+	for _, endpoint := range endpoints {
+		err = handle(obtainShardPool(endpoint, mdp.dbInfo.name))
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// ensureShardTables 分片表需要在所有分片上建表
+func (mdp *Pool) ensureShardTables(table string, ddl func() string) (bool, error) {
+	if mdp.shard {
+		return false, nil
+	}
+
+	router := shardRouterFor(mdp.dbInfo.name, table)
+	if router == nil {
+		return false, nil
+	}
+
+	for _, endpoint := range router.endpoints {
+		err := obtainShardPool(endpoint, mdp.dbInfo.name).ensureTable(table, ddl)
+		if err != nil {
+			return true, fmt.Errorf("分片 %s：%v", endpoint, err)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestShardRouter(previous bool) *shardRouter {
+	router := &shardRouter{
+		key:       "device_id",
+		current:   newShardRing([]string{"a", "b", "c"}, defaultVirtualNodes),
+		endpoints: []string{"a", "b", "c"},
+	}
+
+	if previous {
+		router.previous = newShardRing([]string{"a", "b"}, defaultVirtualNodes)
+	}
+
+	return router
+}
+
+func TestCdcDeleteLocatesShardFromBefore(t *testing.T) {
+	router := newTestShardRouter(false)
+	key := map[string]any{"id": int64(7)}
+	before := map[string]any{"id": int64(7), "device_id": "dev-42", "value": 1.5}
+
+	if _, err := router.targets(key); err == nil {
+		t.Fatal("key 中没有分片键时应报错")
+	}
+
+	got, err := router.targets(cdcLocateRow(key, before))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := router.targets(before)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("删除路由到 %v，写入路由到 %v", got, want)
+	}
+
+	row := cdcLocateRow(map[string]any{"id": int64(8)}, before)
+	if row["id"] != int64(8) {
+		t.Errorf("key 中的值应优先：%v", row["id"])
+	}
+}
+
+func TestShardReadEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous bool
+		row      map[string]any
+	}{
+		{"有分片键", false, map[string]any{"device_id": "dev-42"}},
+		{"迁移期间", true, map[string]any{"device_id": "dev-42"}},
+		{"缺少分片键", false, map[string]any{"hostname": "h1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestShardRouter(tt.previous)
+			got := router.readEndpoints(tt.row)
+
+			want, err := router.targets(tt.row)
+			if err != nil {
+				want = router.endpoints
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("查询 %v，期望 %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 所有指标发布在 expvar 的 venus_data 下，通过 /debug/vars 查看
+var (
+	counters = new(expvar.Map).Init()
+	gauges   = new(expvar.Map).Init()
+	timers   = new(expvar.Map).Init()
+
+	timerLock sync.Mutex
+)
+
+func init() {
+	root := expvar.NewMap("venus_data")
+	root.Set("counters", counters)
+	root.Set("gauges", gauges)
+	root.Set("timers", timers)
+}
+
+// Add 计数器累加
+func Add(name string, delta int64) {
+	counters.Add(name, delta)
+}
+
+// Set 设置瞬时值
+func Set(name string, value int64) {
+	v, ok := gauges.Get(name).(*expvar.Int)
+	if !ok {
+		v = new(expvar.Int)
+		gauges.Set(name, v)
+	}
+
+	v.Set(value)
+}
+
+// Observe 记录一次耗时，保留次数、总耗时和最大耗时（毫秒）
+func Observe(name string, d time.Duration) {
+	timerLock.Lock()
+	defer timerLock.Unlock()
+
+	v, ok := timers.Get(name).(*expvar.Map)
+	if !ok {
+		v = new(expvar.Map).Init()
+		timers.Set(name, v)
+	}
+
+	ms := float64(d) / float64(time.Millisecond)
+	v.Add("count", 1)
+	v.AddFloat("sum_ms", ms)
+
+	max, ok := v.Get("max_ms").(*expvar.Float)
+	if !ok {
+		max = new(expvar.Float)
+		v.Set("max_ms", max)
+	}
+
+	if ms > max.Value() {
+		max.Set(ms)
+	}
+}
+
+// Serve 在 addr 上提供 /debug/vars，阻塞直到出错
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,151 @@
+package selector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pathSegment 选择器中的一级：.key、[n] 或通配 [*]、.*
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Selector 类 JSONPath 的选择器，$ 表示消息根节点，@ 表示当前展开的元素，其余为字面量
+type Selector struct {
+	literal   string
+	isLiteral bool
+	relative  bool
+	segments  []pathSegment
+}
+
+// Compile 解析选择器表达式，不以 $ 或 @ 开头的表达式为字面量
+func Compile(expr string) (*Selector, error) {
+	if expr == "" || (expr[0] != '$' && expr[0] != '@') {
+		return &Selector{literal: expr, isLiteral: true}, nil
+	}
+
+	s := &Selector{relative: expr[0] == '@'}
+	rest := expr[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("选择器 %s 有误：空的字段名", expr)
+			}
+
+			s.segments = append(s.segments, pathSegment{key: key, wildcard: key == "*"})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("选择器 %s 有误：缺少 ]", expr)
+			}
+
+			inner := rest[1:end]
+			switch {
+			case inner == "*":
+				s.segments = append(s.segments, pathSegment{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				s.segments = append(s.segments, pathSegment{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("选择器 %s 有误：%s", expr, inner)
+				}
+
+				s.segments = append(s.segments, pathSegment{index: index, isIndex: true})
+			}
+
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("选择器 %s 有误：%s", expr, rest)
+		}
+	}
+
+	return s, nil
+}
+
+// SelectAll 返回所有匹配的值，通配按顺序展开
+func (s *Selector) SelectAll(root any, current any) []any {
+	if s.isLiteral {
+		return []any{s.literal}
+	}
+
+	values := []any{root}
+	if s.relative {
+		values = []any{current}
+	}
+
+	for _, segment := range s.segments {
+		var next []any
+		for _, value := range values {
+			next = append(next, segment.apply(value)...)
+		}
+
+		values = next
+	}
+
+	return values
+}
+
+// SelectOne 返回第一个匹配的值
+func (s *Selector) SelectOne(root any, current any) (any, bool) {
+	values := s.SelectAll(root, current)
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	return values[0], true
+}
+
+func (p pathSegment) apply(value any) []any {
+	switch v := value.(type) {
+	case map[string]any:
+		if p.wildcard {
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+
+			sort.Strings(keys)
+			values := make([]any, 0, len(keys))
+			for _, key := range keys {
+				values = append(values, v[key])
+			}
+
+			return values
+		}
+
+		if child, ok := v[p.key]; ok && !p.isIndex {
+			return []any{child}
+		}
+	case []any:
+		if p.wildcard {
+			return v
+		}
+
+		if p.isIndex {
+			index := p.index
+			if index < 0 {
+				index += len(v)
+			}
+
+			if index >= 0 && index < len(v) {
+				return []any{v[index]}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package selector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{"cpu", true},
+		{"", true},
+		{"$.metrics[*].name", true},
+		{"@['host name']", true},
+		{"$.values[-1]", true},
+		{"$..name", false},
+		{"$.values[", false},
+		{"$.values[x]", false},
+		{"$name", false},
+	}
+
+	for _, tt := range tests {
+		if _, err := Compile(tt.expr); (err == nil) != tt.valid {
+			t.Errorf("%q：%v，期望合法：%v", tt.expr, err, tt.valid)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	root := map[string]any{
+		"host": "a",
+		"metrics": []any{
+			map[string]any{"name": "cpu", "value": 1.5},
+			map[string]any{"name": "mem", "value": 2.0},
+		},
+	}
+
+	tests := []struct {
+		expr    string
+		current any
+		want    []any
+	}{
+		{"$.host", nil, []any{"a"}},
+		{"$.metrics[*].name", nil, []any{"cpu", "mem"}},
+		{"$.metrics[-1].value", nil, []any{2.0}},
+		{"@.name", root["metrics"].([]any)[0], []any{"cpu"}},
+		{"$.missing", nil, nil},
+		{"literal", nil, []any{"literal"}},
+	}
+
+	for _, tt := range tests {
+		s, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := s.SelectAll(root, tt.current); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s：%v，期望 %v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
 	"venu-data/consumer"
 )
 
 func main() {
 	consumer.Start()
-	select {}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	consumer.Stop()
 }